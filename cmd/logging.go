@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/pplmx/h2h/internal"
+	"github.com/spf13/cobra"
+)
+
+// DefaultLogFile is the log file written in the working directory unless --log-file says otherwise.
+// Only conversions that write posts use it; dry runs, config and restore log only when --log-file is set.
+const DefaultLogFile = "h2h.log"
+
+var (
+	logFile   string
+	logLevel  string
+	logFormat string
+	logOutput *os.File // Open log file, closed when the command is done
+)
+
+// setupLogging creates the logger of --log-file, --log-level and --log-format for the conversion
+func setupLogging(cmd *cobra.Command, args []string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("invalid log level %s: use debug, info, warn or error", logLevel)
+	}
+
+	if !cmd.Flags().Changed("log-file") && (config.DryRun || cmd == siteConfigCmd || cmd == restoreCmd) {
+		return nil // Nothing is converted, so no log file is left behind
+	}
+
+	var w io.Writer
+	switch logFile {
+	case "":
+		return nil // Logging is disabled
+	case "-":
+		w = os.Stderr
+	default:
+		file, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		logOutput, w = file, file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(logFormat) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		closeLogging()
+		return fmt.Errorf("invalid log format %s: use text or json", logFormat)
+	}
+
+	config.Logger = slog.New(handler)
+	config.Logger.Info("starting", "command", cmd.CommandPath(), "args", strings.Join(os.Args[1:], " "))
+	return nil
+}
+
+// closeLogging closes the log file, if one is open
+func closeLogging() {
+	if logOutput != nil {
+		logOutput.Close()
+		logOutput = nil
+	}
+}
+
+// logReport logs the outcome of a conversion run
+func logReport(report *internal.Report, err error) {
+	logger := config.Logger
+	if logger == nil {
+		return
+	}
+	if report != nil {
+		count := func(status internal.FileStatus) int {
+			return report.Count(status, false) + report.Count(status, true)
+		}
+		logger.Info("finished",
+			"converted", count(internal.StatusConverted),
+			"skipped", count(internal.StatusSkipped),
+			"failed", count(internal.StatusFailed),
+			"removed", count(internal.StatusRemoved),
+			"duration", report.Duration)
+	}
+	if err != nil {
+		logger.Error("failed", "error", err)
+	}
+}
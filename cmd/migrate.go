@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/pplmx/h2h/internal"
+	"github.com/spf13/cobra"
+)
+
+var layoutFile string
+
+func initMigrateCmd() {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate a Hexo project to a Hugo site",
+		Long: `migrate converts a whole Hexo project into a Hugo site tree.
+Posts are converted and moved between the two layouts, and other source files are copied:
+
+  source/_posts         -> content/posts
+  source/_drafts        -> content/posts, marked as drafts
+  source/about/index.md -> content/about.md
+  source/images         -> static/images
+
+The path mapping can be extended or replaced with a layout file.`,
+		RunE: runMigration,
+	}
+
+	flags := migrateCmd.Flags()
+	flags.StringVar(&srcDir, "src", "", "root directory of the Hexo project (required)")
+	flags.StringVar(&dstDir, "dst", "", "root directory of the Hugo site to write (required)")
+	flags.StringVar(&layoutFile, "layout", "", "YAML, TOML or JSON file with path rules to merge with or replace the default layout")
+
+	cobra.CheckErr(migrateCmd.MarkFlagRequired("src"))
+	cobra.CheckErr(migrateCmd.MarkFlagRequired("dst"))
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func runMigration(cmd *cobra.Command, args []string) error {
+	if err := loadConfigFiles(); err != nil {
+		return err
+	}
+	config.ConversionDirection = internal.DirectionHexoToHugo
+
+	layout := internal.LayoutRules(nil, false)
+	if layoutFile != "" {
+		file, err := internal.LoadLayoutFile(layoutFile)
+		if err != nil {
+			return err
+		}
+		layout = internal.LayoutRules(file.Rules, file.Replace)
+	} else if projectLayout != nil {
+		layout = internal.LayoutRules(projectLayout.Rules, projectLayout.Replace)
+	}
+
+	fmt.Printf("Migrating Hexo project [%s] to Hugo site [%s] with [%s] front matter\n", srcDir, dstDir, config.TargetFormat)
+
+	srcDirAbs, err := filepath.Abs(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for project directory: %w", err)
+	}
+
+	dstDirAbs, err := filepath.Abs(dstDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for site directory: %w", err)
+	}
+
+	out, err := openReport()
+	if err != nil {
+		return err
+	}
+	report, err := internal.MigrateSite(cmd.Context(), srcDirAbs, dstDirAbs, layout, config)
+	printReport(report)
+	logReport(report, err)
+	reportErr := out.finish(report)
+	if err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	if reportErr != nil {
+		return reportErr
+	}
+
+	if config.DryRun {
+		fmt.Println("Dry run completed, nothing was written")
+		return nil
+	}
+	fmt.Println("Migration completed successfully")
+	return nil
+}
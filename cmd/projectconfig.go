@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pplmx/h2h/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// EnvPrefix starts the names of the environment variables that set options, such as H2H_SRC
+const EnvPrefix = "H2H_"
+
+var (
+	projectFile     string
+	profile         string
+	projectMappings *internal.MappingFile // Key mappings of the project file, unless --mapping is given
+	projectLayout   *internal.LayoutFile  // Path rules of the project file, unless --layout is given
+)
+
+// pathOptions are the options whose values are paths, which a project file gives relative to itself
+var pathOptions = map[string]bool{
+	"src": true, "dst": true, "mapping": true, "layout": true, "manifest": true,
+	"redirects": true, "report": true, "log-file": true, "archive": true,
+}
+
+// directoryOptions are the options that name directories on every command but config, where
+// they name files; they are not set from the environment or the project file for config
+var directoryOptions = map[string]bool{"src": true, "dst": true}
+
+// exclusiveOptions pairs the options that cannot be given together. An option of the project
+// file is left out when the one it excludes is already set, such as dst when --in-place is given.
+var exclusiveOptions = map[string]string{"dst": "in-place", "in-place": "dst"}
+
+// initProjectFlags adds the flags that select the project file and its profile
+func initProjectFlags() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&projectFile, "config", "", "project configuration file (default: the first of "+strings.Join(internal.ProjectFileNames, ", ")+" in the working directory or --src)")
+	flags.StringVar(&profile, "profile", "", "profile of the project configuration file to apply over its top-level settings")
+}
+
+// setupCommand fills in the options that were not given as flags, then sets up logging
+func setupCommand(cmd *cobra.Command, args []string) error {
+	if err := applyProjectConfig(cmd); err != nil {
+		return err
+	}
+	return setupLogging(cmd, args)
+}
+
+// applyProjectConfig sets the options of cmd that were not given as flags from H2H_* environment
+// variables, then from the selected profile of the project file, then from its top level
+func applyProjectConfig(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || !settable(cmd, flag.Name) {
+			return
+		}
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := flags.Set(flag.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q of %s: %w", value, name, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	path := projectFile
+	if path == "" {
+		dirs := []string{"."}
+		if srcDir != "" {
+			dirs = append(dirs, srcDir)
+		}
+		path = internal.FindProjectFile(dirs...)
+	}
+	if path == "" {
+		if profile != "" {
+			return fmt.Errorf("--profile %s needs a project file", profile)
+		}
+		return nil
+	}
+
+	file, err := internal.LoadProjectFile(path)
+	if err != nil {
+		return err
+	}
+	settings, err := file.Settings(profile)
+	if err != nil {
+		return err
+	}
+	projectMappings, projectLayout = settings.Mappings, settings.Layout
+
+	// The profile is applied first, so its options win over the top level and over options
+	// of the top level they exclude
+	known := optionNames(rootCmd)
+	for _, options := range []map[string]string{file.Profiles[profile].Options, file.Options} {
+		names := make([]string, 0, len(options))
+		for name := range options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if !known[name] {
+				return fmt.Errorf("project file %s: unknown option %s", path, name)
+			}
+			flag := flags.Lookup(name)
+			if flag == nil || flag.Changed || !settable(cmd, name) {
+				continue // An option of another command, or given as a flag or environment variable
+			}
+			if other := flags.Lookup(exclusiveOptions[name]); other != nil && other.Changed {
+				continue
+			}
+			value := options[name]
+			if pathOptions[name] && value != "" && value != "-" && !filepath.IsAbs(value) {
+				value = filepath.Join(filepath.Dir(path), value)
+			}
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("project file %s: invalid value %q of %s: %w", path, value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// settable reports whether the option name of cmd may be set from the environment or the
+// project file
+func settable(cmd *cobra.Command, name string) bool {
+	return !(cmd == siteConfigCmd && directoryOptions[name])
+}
+
+// optionNames returns the names of the flags of cmd and its subcommands that a project file may
+// set; the file cannot select itself or its profile
+func optionNames(cmd *cobra.Command) map[string]bool {
+	names := make(map[string]bool)
+	var visit func(*cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		add := func(flag *pflag.Flag) { names[flag.Name] = true }
+		cmd.Flags().VisitAll(add)
+		cmd.PersistentFlags().VisitAll(add)
+		for _, sub := range cmd.Commands() {
+			visit(sub)
+		}
+	}
+	visit(cmd)
+	delete(names, "config")
+	delete(names, "profile")
+	delete(names, "help")
+	return names
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pplmx/h2h/internal"
+)
+
+// printReport prints what a conversion run did: the plan of a dry run, a summary of the files,
+// and the warnings and errors that were found
+func printReport(report *internal.Report) {
+	if report == nil {
+		return
+	}
+	if report.Backup != "" {
+		fmt.Printf("Backed up %d files to %s\n", report.Count(internal.StatusConverted, false)+report.Count(internal.StatusFailed, false), report.Backup)
+	}
+	if report.DryRun {
+		printPlan(report)
+		if config.RedirectFile != "" {
+			fmt.Printf("Redirect map of %d URLs -> %s\n", report.Redirects, config.RedirectFile)
+		}
+	}
+	for _, file := range report.Files {
+		if file.Status == internal.StatusRemoved {
+			fmt.Printf("Removed %s, as its source %s was deleted\n", file.Destination, relPath(report.SrcDir, file.Source))
+		}
+	}
+
+	placed, unchanged := report.Count(internal.StatusConverted, true), report.Count(internal.StatusSkipped, true)
+	fmt.Printf("Processed %d files\n", report.Count(internal.StatusConverted, false)+placed+unchanged)
+	if placed+unchanged > 0 {
+		fmt.Printf("Assets: %d placed, %d unchanged\n", placed, unchanged)
+	}
+	if skipped := report.Count(internal.StatusSkipped, false); skipped > 0 {
+		fmt.Printf("Skipped %d posts\n", skipped)
+	}
+	if config.SourceFormat == internal.FormatAuto {
+		printDetectedFormats(report)
+	}
+	for _, file := range report.Files {
+		printWarnings(report.SrcDir, file)
+	}
+	for _, err := range report.Errors {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+}
+
+// printPlan prints what a dry run would do with each file: where it would be written, how its
+// front matter keys would change, and the diff if one was computed
+func printPlan(report *internal.Report) {
+	for _, file := range report.Files {
+		if file.Status != internal.StatusConverted {
+			continue // Failed, reported with the errors
+		}
+		path := relPath(report.SrcDir, file.Source)
+		if file.Asset != "" {
+			fmt.Printf("%s -> %s (%s)\n", path, file.Destination, file.Asset)
+			continue
+		}
+
+		fmt.Printf("%s -> %s\n", path, file.Destination)
+		for _, rename := range file.Renamed {
+			fmt.Printf("  renamed: %s -> %s\n", rename.From, strings.Join(rename.To, ", "))
+		}
+		if len(file.Added) > 0 {
+			fmt.Printf("  added: %s\n", strings.Join(file.Added, ", "))
+		}
+		if len(file.Removed) > 0 {
+			fmt.Printf("  removed: %s\n", strings.Join(file.Removed, ", "))
+		}
+		if file.Diff != "" {
+			fmt.Print(file.Diff)
+		}
+	}
+}
+
+// printDetectedFormats prints the front matter format detected for each post
+func printDetectedFormats(report *internal.Report) {
+	counts := make(map[internal.Format]int)
+	var files []internal.FileReport
+	for _, file := range report.Files {
+		if file.Format != "" {
+			counts[file.Format]++
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Source < files[j].Source })
+
+	formats := make([]string, 0, len(counts))
+	for format, count := range counts {
+		formats = append(formats, fmt.Sprintf("%s=%d", format, count))
+	}
+	sort.Strings(formats)
+
+	fmt.Printf("Detected front matter formats: %s\n", strings.Join(formats, ", "))
+	for _, file := range files {
+		fmt.Printf("  %s: %s\n", relPath(report.SrcDir, file.Source), file.Format)
+	}
+}
+
+// printWarnings prints the problems that did not stop the conversion of a file
+func printWarnings(srcDir string, file internal.FileReport) {
+	path := relPath(srcDir, file.Source)
+	for _, warning := range file.Warnings {
+		if warning.Line == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", path, warning.Message)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s:%d: %s\n", path, warning.Line, warning.Message)
+	}
+}
+
+// printEvent prints a file that watch mode converted, placed, removed or failed on, with the
+// time it happened
+func printEvent(srcDir string, file internal.FileReport) {
+	now := time.Now().Format(time.TimeOnly)
+	path := relPath(srcDir, file.Source)
+	switch {
+	case file.Status == internal.StatusFailed:
+		fmt.Fprintf(os.Stderr, "%s Error: %v\n", now, file.Error)
+	case file.Status == internal.StatusRemoved:
+		fmt.Printf("%s deleted %s, removed %s\n", now, path, file.Destination)
+	case file.Asset != "":
+		fmt.Printf("%s placed %s -> %s (%s)\n", now, path, file.Destination, file.Asset)
+	default:
+		if file.RenamedFrom != "" {
+			fmt.Printf("%s renamed %s -> %s\n", now, relPath(srcDir, file.RenamedFrom), path)
+		}
+		fmt.Printf("%s converted %s -> %s\n", now, path, file.Destination)
+	}
+	printWarnings(srcDir, file)
+}
+
+// relPath returns path relative to dir, or path itself if it is not below dir
+func relPath(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// reportOutput is the machine-readable report of --report
+type reportOutput struct {
+	file   *os.File
+	writer *internal.ReportWriter
+}
+
+// openReport creates the file of --report, if it is set, and has the files of the run passed to
+// it as soon as they are done
+func openReport() (*reportOutput, error) {
+	if reportFile == "" {
+		return nil, nil
+	}
+	format := internal.ReportFormat(reportFmt)
+	if format == "" {
+		format = internal.ReportFormatFor(reportFile)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(reportFile), 0755); err != nil {
+		return nil, fmt.Errorf("creating report directory: %w", err)
+	}
+	file, err := os.Create(reportFile)
+	if err != nil {
+		return nil, fmt.Errorf("creating report: %w", err)
+	}
+	writer, err := internal.NewReportWriter(file, format)
+	if err != nil {
+		file.Close()
+		os.Remove(reportFile)
+		return nil, err
+	}
+	config.OnFile = writer.File
+	return &reportOutput{file: file, writer: writer}, nil
+}
+
+// finish writes the report of a run, if there is one, and closes the report file
+func (out *reportOutput) finish(report *internal.Report) error {
+	if out == nil {
+		return nil
+	}
+	var err error
+	if report != nil {
+		err = out.writer.Finish(report)
+	}
+	if closeErr := out.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing report %s: %w", reportFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/pplmx/h2h/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	archiveFile string
+	restoreCmd  *cobra.Command
+)
+
+func initRestoreCmd() {
+	restoreCmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Roll back an in-place conversion from its backups",
+		Long: `restore rolls back a conversion made with --in-place.
+Files are restored from the latest backup archive in the .h2h-backup directory, or from
+the archive given with --archive. Without archives, the .bak copies that h2h made next
+to the files are moved back over them.`,
+		RunE: runRestore,
+	}
+
+	flags := restoreCmd.Flags()
+	flags.StringVar(&srcDir, "src", "", "directory that was converted in place (required)")
+	flags.StringVar(&archiveFile, "archive", "", "backup archive to restore (default: the latest one)")
+
+	cobra.CheckErr(restoreCmd.MarkFlagRequired("src"))
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	srcDirAbs, err := filepath.Abs(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for source directory: %w", err)
+	}
+
+	count, err := internal.RestoreBackup(srcDirAbs, archiveFile)
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	fmt.Printf("Restored %d files in [%s]\n", count, srcDir)
+	return nil
+}
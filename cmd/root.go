@@ -1,23 +1,35 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/pplmx/h2h/internal"
 	"github.com/spf13/cobra"
 )
 
 var (
-	srcDir  string
-	dstDir  string
-	config  *internal.Config
-	rootCmd *cobra.Command
+	srcDir      string
+	dstDir      string
+	mappingFile string
+	timezone    string
+	reportFile  string
+	reportFmt   string
+	config      *internal.Config
+	rootCmd     *cobra.Command
 )
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Stop cleanly on Ctrl-C or SIGTERM; a second signal terminates at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	closeLogging()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -27,6 +39,11 @@ func init() {
 	config = internal.NewDefaultConfig()
 	initRootCmd()
 	initFlags()
+	initProjectFlags()
+	initMigrateCmd()
+	initSiteConfigCmd()
+	initRestoreCmd()
+	initWatchCmd()
 }
 
 func initRootCmd() {
@@ -39,25 +56,87 @@ The tool processes Markdown files with either Hexo or Hugo FrontMatter and conve
 Converted files are written to the specified destination directory.
 
 By default, it converts from Hexo to Hugo format using YAML.`,
-		RunE: runConversion,
+		PersistentPreRunE: setupCommand,
+		RunE:              runConversion,
 	}
 }
 
 func initFlags() {
 	flags := rootCmd.Flags()
 	flags.StringVar(&srcDir, "src", "", "source directory containing Markdown files to convert (required)")
-	flags.StringVar(&dstDir, "dst", "", "destination directory to write converted Markdown files (required)")
-	flags.StringVar((*string)(&config.SourceFormat), "source-format", string(config.SourceFormat), "source FrontMatter format (yaml or toml)")
-	flags.StringVar((*string)(&config.TargetFormat), "target-format", string(config.TargetFormat), "target FrontMatter format (yaml or toml)")
+	flags.StringVar(&dstDir, "dst", "", "destination directory to write converted Markdown files (required unless --in-place)")
+	flags.StringVar((*string)(&config.ConversionDirection), "direction", string(config.ConversionDirection), "conversion direction (hexo2hugo or hugo2hexo)")
+	flags.BoolVar(&config.InPlace, "in-place", config.InPlace, "rewrite the Markdown files under --src instead of writing them to --dst")
+	flags.StringVar((*string)(&config.Backup), "backup", string(internal.BackupNone), "how --in-place backs up the files it rewrites (none, bak or archive)")
+	flags.BoolVar(&config.Incremental, "incremental", config.Incremental, "skip posts that are unchanged since the last run, as recorded in a manifest")
+	flags.StringVar(&config.ManifestFile, "manifest", "", "manifest file of --incremental (default: "+internal.DefaultManifestFile+" in --dst)")
+	flags.BoolVar(&config.Force, "force", config.Force, "with --incremental, overwrite outputs edited by hand since the last run")
+	flags.BoolVar(&config.Prune, "prune", config.Prune, "with --incremental, remove the outputs of posts whose source was deleted")
+
+	// Conversion options shared with subcommands
+	flags = rootCmd.PersistentFlags()
+	flags.StringVar((*string)(&config.SourceFormat), "source-format", string(config.SourceFormat), "source FrontMatter format (yaml, toml, json or auto to detect per file)")
+	flags.StringVar((*string)(&config.TargetFormat), "target-format", string(config.TargetFormat), "target FrontMatter format (yaml, toml or json)")
 	flags.StringVar(&config.FileExtension, "file-extension", config.FileExtension, "file extension for Markdown files")
 	flags.IntVar(&config.MaxConcurrency, "max-concurrency", config.MaxConcurrency, "maximum number of concurrent file conversions")
-	flags.StringVar((*string)(&config.ConversionDirection), "direction", string(config.ConversionDirection), "conversion direction (hexo2hugo or hugo2hexo)")
+	flags.IntVar(&config.JSONIndent, "json-indent", config.JSONIndent, "spaces per indentation level in JSON output (0 for compact)")
+	flags.BoolVar(&config.JSONFenced, "json-fenced", config.JSONFenced, "fence JSON output with ;;; as Hexo allows")
+	flags.StringVar(&mappingFile, "mapping", "", "YAML, TOML or JSON file with key mapping rules to merge with or replace the built-in ones")
+	flags.StringVar(&timezone, "timezone", "", "time zone of dates without an offset, as an IANA name or offset such as +08:00 (default: leave dates as they are)")
+	flags.BoolVar(&config.ConvertTags, "convert-tags", config.ConvertTags, "rewrite Hexo tag plugins or Hugo shortcodes in the Markdown body")
+	flags.StringVar(&config.OldPermalink, "old-permalink", "", "Hexo permalink pattern of the source site, such as :year/:month/:day/:title/, to add old URLs to aliases")
+	flags.StringVar(&config.NewPermalink, "new-permalink", config.NewPermalink, "Hugo permalink pattern of the converted posts, used for the redirect map")
+	flags.StringVar(&config.RedirectFile, "redirects", "", "file to write a redirect map from old to new URLs to (requires --old-permalink)")
+	flags.StringVar((*string)(&config.RedirectFormat), "redirect-format", "", "redirect map format (netlify, nginx or csv; default: inferred from the file name)")
+	flags.StringVar((*string)(&config.AssetMode), "assets", string(config.AssetMode), "how to place files other than posts in the destination (none, copy, hardlink or symlink)")
+	flags.StringSliceVar(&config.AssetInclude, "asset-include", nil, "globs of the assets to place (default: all)")
+	flags.StringSliceVar(&config.AssetExclude, "asset-exclude", nil, "globs of the assets to leave out")
+	flags.StringVar((*string)(&config.AssetUnchanged), "asset-unchanged", string(config.AssetUnchanged), "how copied assets are recognised as unchanged and skipped (size, mtime or hash)")
+	flags.BoolVar(&config.Bundles, "bundles", config.Bundles, "restructure Hexo post asset folders as Hugo page bundles, or page bundles as post asset folders")
+	flags.BoolVar(&config.DryRun, "dry-run", config.DryRun, "show where each file would be written and how its front matter keys change, without writing anything")
+	flags.BoolVar(&config.Diff, "diff", config.Diff, "with --dry-run, also show a unified diff of each post")
+	flags.StringVar(&reportFile, "report", "", "file to write a machine-readable report of the run to")
+	flags.StringVar(&reportFmt, "report-format", "", "report format (json, jsonl or junit; default: inferred from the file name)")
+	flags.StringVar(&logFile, "log-file", DefaultLogFile, "file to append the log to, - for stderr, or empty to disable logging; dry runs, config and restore only log to a file given here")
+	flags.StringVar(&logLevel, "log-level", "info", "lowest level of log events to write (debug, info, warn or error)")
+	flags.StringVar(&logFormat, "log-format", "text", "log format (text or json)")
+	flags.StringSliceVar(&config.KeyOrder, "key-order", config.KeyOrder, "keys written first in TOML and JSON output; the rest keep their source order")
 
 	cobra.CheckErr(rootCmd.MarkFlagRequired("src"))
-	cobra.CheckErr(rootCmd.MarkFlagRequired("dst"))
+	rootCmd.MarkFlagsMutuallyExclusive("dst", "in-place")
+	rootCmd.MarkFlagsOneRequired("dst", "in-place")
+}
+
+// loadConfigFiles resolves the options of config that are given as names or files
+func loadConfigFiles() error {
+	loc, err := internal.LoadTimezone(timezone)
+	if err != nil {
+		return err
+	}
+	config.Timezone = loc
+
+	if mappingFile != "" {
+		mappings, err := internal.LoadMappingFile(mappingFile)
+		if err != nil {
+			return err
+		}
+		config.KeyMappings = mappings.Rules
+		config.ReplaceKeyMappings = mappings.Replace
+	} else if projectMappings != nil {
+		config.KeyMappings = projectMappings.Rules
+		config.ReplaceKeyMappings = projectMappings.Replace
+	}
+	return nil
 }
 
 func runConversion(cmd *cobra.Command, args []string) error {
+	if err := loadConfigFiles(); err != nil {
+		return err
+	}
+
+	if config.InPlace {
+		dstDir = srcDir
+	}
 	fmt.Printf("Starting conversion from [%s] to [%s] format, direction: %s, output will be written to [%s]\n",
 		config.SourceFormat, config.TargetFormat, config.ConversionDirection, dstDir)
 
@@ -71,10 +150,25 @@ func runConversion(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get absolute path for destination directory: %w", err)
 	}
 
-	if err := internal.ConvertPosts(srcDirAbs, dstDirAbs, config); err != nil {
+	out, err := openReport()
+	if err != nil {
+		return err
+	}
+	report, err := internal.ConvertPosts(cmd.Context(), srcDirAbs, dstDirAbs, config)
+	printReport(report)
+	logReport(report, err)
+	reportErr := out.finish(report)
+	if err != nil {
 		return fmt.Errorf("conversion failed: %w", err)
 	}
+	if reportErr != nil {
+		return reportErr
+	}
 
+	if config.DryRun {
+		fmt.Println("Dry run completed, nothing was written")
+		return nil
+	}
 	fmt.Println("Conversion completed successfully")
 	return nil
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pplmx/h2h/internal"
+	"github.com/spf13/cobra"
+)
+
+// siteConfigFormats maps site configuration file extensions to their format
+var siteConfigFormats = map[string]internal.Format{
+	".yaml": internal.FormatYAML,
+	".yml":  internal.FormatYAML,
+	".toml": internal.FormatTOML,
+	".json": internal.FormatJSON,
+}
+
+// siteConfigCmd is the config command, whose --src and --dst name files rather than directories
+var siteConfigCmd *cobra.Command
+
+func initSiteConfigCmd() {
+	siteConfigCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Translate a Hexo _config.yml into a Hugo site configuration",
+		Long: `config translates the site configuration of a Hexo project into a Hugo configuration,
+or a Hugo configuration into a Hexo _config.yml with --direction hugo2hexo.
+
+Formats are taken from the file extensions, falling back to YAML for the source and
+--target-format for the output. Settings that cannot be translated are listed in a
+comment at the top of the output and reported as warnings.`,
+		RunE: runSiteConfig,
+	}
+
+	flags := siteConfigCmd.Flags()
+	flags.StringVar(&srcDir, "src", "", "site configuration file to translate, such as _config.yml (required)")
+	flags.StringVar(&dstDir, "dst", "", "file to write the translated configuration to, such as hugo.toml (default: standard output)")
+	flags.StringVar((*string)(&config.ConversionDirection), "direction", string(config.ConversionDirection), "conversion direction (hexo2hugo or hugo2hexo)")
+
+	cobra.CheckErr(siteConfigCmd.MarkFlagRequired("src"))
+	rootCmd.AddCommand(siteConfigCmd)
+}
+
+func runSiteConfig(cmd *cobra.Command, args []string) error {
+	sourceFormat, ok := siteConfigFormats[strings.ToLower(filepath.Ext(srcDir))]
+	if !ok {
+		sourceFormat = internal.FormatYAML
+	}
+	if format, ok := siteConfigFormats[strings.ToLower(filepath.Ext(dstDir))]; ok {
+		config.TargetFormat = format
+	}
+
+	data, err := os.ReadFile(srcDir)
+	if err != nil {
+		return fmt.Errorf("reading site configuration: %w", err)
+	}
+
+	converted, notes, err := internal.ConvertSiteConfig(data, sourceFormat, config)
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "Warning: %s: not translated: %s\n", srcDir, note)
+	}
+
+	if dstDir == "" {
+		_, err = os.Stdout.Write(converted)
+		return err
+	}
+	if err := os.WriteFile(dstDir, converted, 0644); err != nil {
+		return fmt.Errorf("writing site configuration: %w", err)
+	}
+	fmt.Printf("Site configuration written to [%s]\n", dstDir)
+	return nil
+}
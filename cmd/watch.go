@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pplmx/h2h/internal"
+	"github.com/spf13/cobra"
+)
+
+func initWatchCmd() {
+	watchCmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Keep a converted tree up to date as its sources change",
+		Long: `watch converts the posts under --src into --dst, then keeps watching --src and
+converts each post again when it changes. Deleted and renamed posts are mirrored in
+--dst, and assets are placed as --assets says.
+
+The source directory is polled, so watch works on every file system. A post is
+converted once it has been left alone for --debounce, so a burst of saves
+converts it once. Stop watching with Ctrl-C.`,
+		RunE: runWatch,
+	}
+
+	flags := watchCmd.Flags()
+	flags.StringVar(&srcDir, "src", "", "source directory containing Markdown files to watch (required)")
+	flags.StringVar(&dstDir, "dst", "", "destination directory to keep up to date (required)")
+	flags.StringVar((*string)(&config.ConversionDirection), "direction", string(config.ConversionDirection), "conversion direction (hexo2hugo or hugo2hexo)")
+	flags.DurationVar(&config.PollInterval, "interval", config.PollInterval, "how often to scan --src for changes")
+	flags.DurationVar(&config.Debounce, "debounce", config.Debounce, "how long a changed file must be left alone before it is converted")
+
+	cobra.CheckErr(watchCmd.MarkFlagRequired("src"))
+	cobra.CheckErr(watchCmd.MarkFlagRequired("dst"))
+	rootCmd.AddCommand(watchCmd)
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if err := loadConfigFiles(); err != nil {
+		return err
+	}
+
+	srcDirAbs, err := filepath.Abs(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for source directory: %w", err)
+	}
+
+	dstDirAbs, err := filepath.Abs(dstDir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for destination directory: %w", err)
+	}
+
+	fmt.Printf("Watching [%s] for changes, output will be written to [%s]\n", srcDir, dstDir)
+	out, err := openReport()
+	if err != nil {
+		return err
+	}
+	if out != nil && !out.writer.Streaming() {
+		out.finish(nil)
+		return errors.New("watch can only write JSON Lines reports")
+	}
+
+	events := func(file internal.FileReport) {
+		printEvent(srcDirAbs, file)
+		if out != nil {
+			out.writer.File(file)
+		}
+	}
+	err = internal.WatchPosts(cmd.Context(), srcDirAbs, dstDirAbs, config, events)
+	reportErr := out.finish(nil)
+	if err != nil {
+		return fmt.Errorf("watch failed: %w", err)
+	}
+	if reportErr != nil {
+		return reportErr
+	}
+
+	fmt.Println("Stopped watching")
+	return nil
+}
@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RedirectFormat is the format of a redirect map
+type RedirectFormat string
+
+// Redirect map formats
+const (
+	RedirectNetlify RedirectFormat = "netlify" // Netlify _redirects file
+	RedirectNginx   RedirectFormat = "nginx"   // Entries of an nginx map block
+	RedirectCSV     RedirectFormat = "csv"
+
+	DefaultNewPermalink = "/posts/:slugorfilename/"
+)
+
+// ErrURLCollision is returned when two posts had the same URL on the source site
+var ErrURLCollision = errors.New("old URL collision")
+
+// slugPattern matches the runs of characters Hexo replaces with a dash in slugs
+var slugPattern = regexp.MustCompile("[\\s~`!@#$%^&*()\\-_+=\\[\\]{}|\\\\;:\"'<>,.?/]+")
+
+// postURLs are the URLs of a post on the source and the converted site
+type postURLs struct {
+	old string
+	new string
+}
+
+// postInfo is what permalink tokens are computed from
+type postInfo struct {
+	name    string // Path of the post relative to its posts directory, without extension
+	date    time.Time
+	hasDate bool
+	mapping *yaml.Node
+}
+
+// permalinkToken computes the value of a permalink token for a post
+type permalinkToken func(post postInfo) (string, bool)
+
+// hexoURLTokens are the Hexo permalink tokens old URLs can be computed from
+var hexoURLTokens = map[string]permalinkToken{
+	"year":       dateToken("2006"),
+	"month":      dateToken("01"),
+	"i_month":    dateToken("1"),
+	"day":        dateToken("02"),
+	"i_day":      dateToken("2"),
+	"hour":       dateToken("15"),
+	"minute":     dateToken("04"),
+	"second":     dateToken("05"),
+	"title":      func(post postInfo) (string, bool) { return post.name, true },
+	"name":       func(post postInfo) (string, bool) { return path.Base(post.name), true },
+	"post_title": stringToken("title", slugize),
+	"category":   hexoCategoryToken,
+}
+
+// hugoURLTokens are the Hugo permalink tokens new URLs can be computed from
+var hugoURLTokens = map[string]permalinkToken{
+	"year":            dateToken("2006"),
+	"month":           dateToken("01"),
+	"day":             dateToken("02"),
+	"filename":        func(post postInfo) (string, bool) { return path.Base(post.name), true },
+	"contentbasename": func(post postInfo) (string, bool) { return path.Base(post.name), true },
+	"slug":            stringToken("slug", nil),
+	"title":           stringToken("title", urlize),
+	"slugorfilename": func(post postInfo) (string, bool) {
+		if slug, ok := stringToken("slug", nil)(post); ok {
+			return slug, true
+		}
+		return path.Base(post.name), true
+	},
+}
+
+// dateToken returns a permalink token that formats the post's date
+func dateToken(layout string) permalinkToken {
+	return func(post postInfo) (string, bool) {
+		return post.date.Format(layout), post.hasDate
+	}
+}
+
+// stringToken returns a permalink token that reads a front matter string, optionally rewritten by fn
+func stringToken(key string, fn func(string) string) permalinkToken {
+	return func(post postInfo) (string, bool) {
+		_, value, ok := childNode(post.mapping, pathSegment{key: key, index: -1})
+		if !ok || value.Kind != yaml.ScalarNode || value.Value == "" {
+			return "", false
+		}
+		if fn != nil {
+			return fn(value.Value), true
+		}
+		return value.Value, true
+	}
+}
+
+// hexoCategoryToken computes Hexo's :category token: the slugs of the post's nested
+// categories, or uncategorized
+func hexoCategoryToken(post postInfo) (string, bool) {
+	_, value, ok := childNode(post.mapping, pathSegment{key: "categories", index: -1})
+	if !ok {
+		_, value, ok = childNode(post.mapping, pathSegment{key: "category", index: -1})
+	}
+	if !ok || value.Tag == tagNull {
+		return "uncategorized", true
+	}
+	if value.Kind == yaml.ScalarNode {
+		return slugize(value.Value), true
+	}
+
+	var parts []string
+	for _, item := range value.Content {
+		if item = resolveAlias(item); item.Kind == yaml.ScalarNode {
+			parts = append(parts, slugize(item.Value))
+		}
+	}
+	if len(parts) == 0 {
+		return "uncategorized", true
+	}
+	return strings.Join(parts, "/"), true
+}
+
+// slugize replaces the characters Hexo does not keep in slugs with dashes
+func slugize(s string) string {
+	return strings.Trim(slugPattern.ReplaceAllString(s, "-"), "-")
+}
+
+// urlize lowercases a title and replaces its spaces with dashes, as Hugo does for :title
+func urlize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), "-"))
+}
+
+// expandPermalink fills in the tokens of a permalink pattern. It reports the first token
+// that cannot be computed for the post.
+func expandPermalink(pattern string, tokens map[string]permalinkToken, post postInfo) (string, error) {
+	var failed error
+	expanded := permalinkTokenPattern.ReplaceAllStringFunc(pattern, func(token string) string {
+		fn, ok := tokens[token[1:]]
+		if !ok {
+			failed = fmt.Errorf("unsupported permalink token %s", token)
+			return token
+		}
+		value, ok := fn(post)
+		if !ok && failed == nil {
+			failed = fmt.Errorf("no value for permalink token %s", token)
+		}
+		return value
+	})
+	if failed != nil {
+		return "", failed
+	}
+	return normalizeURLPath(expanded), nil
+}
+
+// normalizeURLPath makes a site-relative URL start with a slash
+func normalizeURLPath(url string) string {
+	return "/" + strings.TrimPrefix(url, "/")
+}
+
+// newPostInfo collects the permalink token inputs of a post from its front matter
+func newPostInfo(mapping *yaml.Node, name string, loc *time.Location) postInfo {
+	post := postInfo{name: strings.TrimSuffix(name, path.Ext(name)), mapping: mapping}
+	if loc == nil {
+		loc = time.UTC
+	}
+	if _, value, ok := childNode(mapping, pathSegment{key: "date", index: -1}); ok && value.Kind == yaml.ScalarNode {
+		if t, _, err := parseDateIn(value.Value, loc); err == nil {
+			post.date, post.hasDate = t.In(loc), true
+		}
+	}
+	return post
+}
+
+// oldPostURL computes the URL a post had on the Hexo site, from its own permalink if it sets one
+func oldPostURL(mapping *yaml.Node, name, pattern string, loc *time.Location) (string, error) {
+	if _, value, ok := childNode(mapping, pathSegment{key: "permalink", index: -1}); ok && value.Kind == yaml.ScalarNode && value.Value != "" {
+		return normalizeURLPath(value.Value), nil
+	}
+	return expandPermalink(pattern, hexoURLTokens, newPostInfo(mapping, name, loc))
+}
+
+// newPostURL computes the URL of a converted post on the Hugo site, from its url key if it sets one
+func newPostURL(mapping *yaml.Node, name, pattern string, loc *time.Location) (string, error) {
+	if _, value, ok := childNode(mapping, pathSegment{key: "url", index: -1}); ok && value.Kind == yaml.ScalarNode && value.Value != "" {
+		return normalizeURLPath(value.Value), nil
+	}
+	return expandPermalink(pattern, hugoURLTokens, newPostInfo(mapping, name, loc))
+}
+
+// addAlias appends url to the aliases of a front matter mapping, unless it is already listed
+func addAlias(mapping *yaml.Node, url string) {
+	_, aliases, ok := childNode(mapping, pathSegment{key: "aliases", index: -1})
+	if !ok {
+		mapping.Content = append(mapping.Content, scalarNode(tagString, "aliases"), &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"})
+		aliases = mapping.Content[len(mapping.Content)-1]
+	} else if aliases.Kind == yaml.ScalarNode {
+		*aliases = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{scalarNode(tagString, aliases.Value)}, LineComment: aliases.LineComment}
+	}
+
+	for _, alias := range aliases.Content {
+		if alias.Value == url {
+			return
+		}
+	}
+	aliases.Content = append(aliases.Content, scalarNode(tagString, url))
+}
+
+// sortedPaths returns the post paths of urls in order
+func sortedPaths(urls map[string]postURLs) []string {
+	paths := make([]string, 0, len(urls))
+	for path := range urls {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// urlCollisions reports the posts whose old URL was already claimed by another post.
+// Posts are visited in path order, so the first post keeps the URL. Aliases are added while
+// posts are converted, before collisions are known, so every colliding post still lists the URL
+// in its aliases; the error asks for one of them to be fixed.
+func urlCollisions(urls map[string]postURLs) []*ConversionError {
+	var collisions []*ConversionError
+	claimed := make(map[string]string)
+	for _, path := range sortedPaths(urls) {
+		old := urls[path].old
+		if other, ok := claimed[old]; ok {
+			collisions = append(collisions, &ConversionError{SourceFile: path, Err: fmt.Errorf("%w: %s is also the old URL of %s", ErrURLCollision, old, other)})
+			continue
+		}
+		claimed[old] = path
+	}
+	return collisions
+}
+
+// redirectMap maps the old URL of each post to its new URL, leaving out posts whose URL did not
+// change. A colliding old URL redirects to the first post in path order, though the aliases of
+// every post that claims it list it, as urlCollisions notes.
+func redirectMap(urls map[string]postURLs) map[string]string {
+	redirects := make(map[string]string)
+	for _, path := range sortedPaths(urls) {
+		u := urls[path]
+		if _, ok := redirects[u.old]; !ok && u.new != "" && u.new != u.old {
+			redirects[u.old] = u.new
+		}
+	}
+	return redirects
+}
+
+// redirectFormatFor infers the redirect map format from a file name
+func redirectFormatFor(file string) RedirectFormat {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return RedirectCSV
+	case ".map", ".conf":
+		return RedirectNginx
+	}
+	return RedirectNetlify
+}
+
+// writeRedirects writes the old and new URL of every post to a redirect map
+func writeRedirects(ctx context.Context, file string, format RedirectFormat, redirects map[string]string) error {
+	if format == "" {
+		format = redirectFormatFor(file)
+	}
+
+	olds := make([]string, 0, len(redirects))
+	for old := range redirects {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+
+	var buf bytes.Buffer
+	switch format {
+	case RedirectNetlify:
+		for _, old := range olds {
+			fmt.Fprintf(&buf, "%s %s 301\n", old, redirects[old])
+		}
+	case RedirectNginx:
+		for _, old := range olds {
+			fmt.Fprintf(&buf, "%s %s;\n", old, redirects[old])
+		}
+	case RedirectCSV:
+		writer := csv.NewWriter(&buf)
+		records := [][]string{{"old", "new"}}
+		for _, old := range olds {
+			records = append(records, []string{old, redirects[old]})
+		}
+		if err := writer.WriteAll(records); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: redirect format %s", ErrUnsupportedFormat, format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("creating redirect map directory: %w", err)
+	}
+	return writeAtomic(ctx, file, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AssetMode is how files other than posts are placed in the destination
+type AssetMode string
+
+// UnchangedCheck is how an asset already in the destination is recognised as unchanged
+type UnchangedCheck string
+
+// Asset modes and unchanged checks
+const (
+	AssetNone     AssetMode = "none" // Leave assets out of the destination
+	AssetCopy     AssetMode = "copy"
+	AssetHardlink AssetMode = "hardlink"
+	AssetSymlink  AssetMode = "symlink"
+
+	UnchangedSize  UnchangedCheck = "size"  // Same size
+	UnchangedMtime UnchangedCheck = "mtime" // Same size and modification time
+	UnchangedHash  UnchangedCheck = "hash"  // Same SHA-256 of the content
+)
+
+// Asset errors
+var (
+	ErrInvalidAssetMode = errors.New("invalid asset mode")
+	ErrInvalidGlob      = errors.New("invalid glob pattern")
+)
+
+// validateAssetOptions checks the asset mode, unchanged check and globs of cfg
+func validateAssetOptions(cfg *Config) error {
+	switch cfg.AssetMode {
+	case "", AssetNone, AssetCopy, AssetHardlink, AssetSymlink:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidAssetMode, cfg.AssetMode)
+	}
+	switch cfg.AssetUnchanged {
+	case "", UnchangedSize, UnchangedMtime, UnchangedHash:
+	default:
+		return fmt.Errorf("%w: unchanged check %s", ErrInvalidAssetMode, cfg.AssetUnchanged)
+	}
+	for _, pattern := range append(append([]string{}, cfg.AssetInclude...), cfg.AssetExclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidGlob, pattern)
+		}
+	}
+	return nil
+}
+
+// includeAsset reports whether the asset at the slash-separated relPath passes the include and
+// exclude globs of cfg. With include globs, an asset must match one of them.
+func includeAsset(relPath string, cfg *Config) bool {
+	if len(cfg.AssetInclude) > 0 && !matchAnyGlob(cfg.AssetInclude, relPath) {
+		return false
+	}
+	return !matchAnyGlob(cfg.AssetExclude, relPath)
+}
+
+// matchAnyGlob reports whether relPath or one of its parent directories matches a pattern.
+// Patterns without a slash are matched against single path segments, so *.psd matches at any depth.
+func matchAnyGlob(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		for p := relPath; p != "." && p != "/"; p = path.Dir(p) {
+			name := p
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(p)
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// transferAsset places the file at src at dst by copying, hard-linking or symlinking it. It
+// reports false when dst already holds the same file, as decided by check for copies.
+func transferAsset(ctx context.Context, src, dst string, mode AssetMode, check UnchangedCheck) (bool, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, fmt.Errorf("reading source file: %w", err)
+	}
+	dstInfo, err := os.Lstat(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("reading destination file: %w", err)
+	}
+	exists := err == nil
+
+	switch mode {
+	case AssetHardlink:
+		if exists && os.SameFile(srcInfo, dstInfo) {
+			return false, nil
+		}
+		return true, replaceWithLink(dst, func(path string) error { return os.Link(src, path) })
+
+	case AssetSymlink:
+		target, err := filepath.Abs(src)
+		if err != nil {
+			return false, err
+		}
+		if exists && dstInfo.Mode()&os.ModeSymlink != 0 {
+			if current, err := os.Readlink(dst); err == nil && current == target {
+				return false, nil
+			}
+		}
+		return true, replaceWithLink(dst, func(path string) error { return os.Symlink(target, path) })
+
+	default:
+		if exists && dstInfo.Mode().IsRegular() {
+			unchanged, err := sameContent(src, dst, srcInfo, dstInfo, check)
+			if err != nil || unchanged {
+				return false, err
+			}
+		}
+		return true, copyFile(ctx, src, dst)
+	}
+}
+
+// replaceWithLink creates a link with create under a temporary name next to dst, then renames it
+// over dst. Like a copy, the link replaces the file at dst rather than writing through it.
+func replaceWithLink(dst string, create func(path string) error) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("creating destination directory: %w", err)
+	}
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".link.tmp")
+	os.Remove(tmp) // Left over from an interrupted run
+	if err := create(tmp); err != nil {
+		return fmt.Errorf("creating link: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("replacing destination file: %w", err)
+	}
+	return nil
+}
+
+// sameContent reports whether the copy at dst is unchanged from src by check
+func sameContent(src, dst string, srcInfo, dstInfo os.FileInfo, check UnchangedCheck) (bool, error) {
+	if srcInfo.Size() != dstInfo.Size() {
+		return false, nil
+	}
+	switch check {
+	case UnchangedSize:
+		return true, nil
+	case UnchangedHash:
+		srcHash, err := fileHash(src)
+		if err != nil {
+			return false, err
+		}
+		dstHash, err := fileHash(dst)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(srcHash, dstHash), nil
+	default:
+		return srcInfo.ModTime().Equal(dstInfo.ModTime()), nil
+	}
+}
+
+// fileHash returns the SHA-256 of a file's content
+func fileHash(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("hashing file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("hashing file: %w", err)
+	}
+	return h.Sum(nil), nil
+}
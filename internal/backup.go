@@ -0,0 +1,346 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupMode is how the files an in-place conversion rewrites are backed up
+type BackupMode string
+
+// Backup modes
+const (
+	BackupNone    BackupMode = "none"
+	BackupBak     BackupMode = "bak"     // Copy each file to <name>.bak next to it
+	BackupArchive BackupMode = "archive" // Write all files to a timestamped archive in BackupDir
+
+	BackupSuffix = ".bak"
+	BackupDir    = ".h2h-backup" // Directory of backup archives, relative to the converted tree
+	BackupList   = "bak-files"   // File in BackupDir listing the .bak copies h2h made, relative to the converted tree
+)
+
+// backupStampLayout names backup archives after the time they were written. Archives written in
+// the same second get a -1, -2, ... suffix.
+const backupStampLayout = "20060102-150405"
+
+// Backup errors
+var (
+	ErrInvalidBackupMode = errors.New("invalid backup mode")
+	ErrNoBackup          = errors.New("no backup to restore")
+	ErrBackupExists      = errors.New("backup file exists and was not made by h2h")
+	ErrSameDirectory     = errors.New("source and destination are the same directory; convert in place instead")
+)
+
+// backupFiles backs up the files an in-place conversion of dir is about to rewrite, and returns
+// the archive they were written to in BackupArchive mode
+func backupFiles(ctx context.Context, dir string, files []string, mode BackupMode) (string, error) {
+	switch mode {
+	case "", BackupNone:
+		return "", nil
+	case BackupBak:
+		if err := writeBakFiles(ctx, dir, files); err != nil {
+			return "", err
+		}
+		return "", nil
+	case BackupArchive:
+		archive, err := writeBackupArchive(dir, files)
+		if err != nil {
+			return "", fmt.Errorf("writing backup archive: %w", err)
+		}
+		return archive, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidBackupMode, mode)
+	}
+}
+
+// writeBakFiles copies each file to a .bak file next to it and records the copies in the backup
+// list of dir. A .bak file made by an earlier run is kept, as it holds the file from before that
+// run converted it; one that h2h did not make is an error, so a user's file is never overwritten.
+func writeBakFiles(ctx context.Context, dir string, files []string) (err error) {
+	listed, err := readBakList(dir)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(listed))
+	for _, name := range listed {
+		known[name] = true
+	}
+
+	defer func() {
+		if listErr := writeBakList(ctx, dir, listed); err == nil {
+			err = listErr
+		}
+	}()
+	for _, file := range files {
+		bak := file + BackupSuffix
+		name, err := filepath.Rel(dir, bak)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if _, err := os.Lstat(bak); err == nil {
+			if !known[name] {
+				return fmt.Errorf("backing up %s: %w: %s", file, ErrBackupExists, bak)
+			}
+			continue
+		}
+		if err := copyFile(ctx, file, bak); err != nil {
+			return fmt.Errorf("backing up %s: %w", file, err)
+		}
+		if !known[name] {
+			known[name] = true
+			listed = append(listed, name)
+		}
+	}
+	return nil
+}
+
+// readBakList returns the .bak copies recorded in the backup list of dir, relative to dir
+func readBakList(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, BackupDir, BackupList))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading backup list: %w", err)
+	}
+	var names []string
+	for _, name := range strings.Split(string(data), "\n") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// writeBakList records the .bak copies under dir, or removes the list if there are none
+func writeBakList(ctx context.Context, dir string, names []string) error {
+	path := filepath.Join(dir, BackupDir, BackupList)
+	if len(names) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing backup list: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	err := writeAtomic(ctx, path, func(w io.Writer) error {
+		_, err := io.WriteString(w, strings.Join(names, "\n")+"\n")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing backup list: %w", err)
+	}
+	return nil
+}
+
+// writeBackupArchive writes files to a new gzipped tarball named after the current time in
+// the backup directory of dir, and returns its path. Entries are named relative to dir.
+func writeBackupArchive(dir string, files []string) (string, error) {
+	backupDir := filepath.Join(dir, BackupDir)
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", err
+	}
+
+	stamp := time.Now().Format(backupStampLayout)
+	var (
+		out  *os.File
+		path string
+		err  error
+	)
+	for i := 0; ; i++ {
+		path = filepath.Join(backupDir, stamp+".tar.gz")
+		if i > 0 {
+			path = filepath.Join(backupDir, fmt.Sprintf("%s-%d.tar.gz", stamp, i))
+		}
+		out, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = writeArchive(out, dir, files)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// writeArchive writes files as a gzipped tarball to w
+func writeArchive(w io.Writer, dir string, files []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		if err := addToArchive(tw, dir, file); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// addToArchive writes a single file to a tarball, named relative to dir
+func addToArchive(tw *tar.Writer, dir, file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	name, err := filepath.Rel(dir, file)
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(tw, in)
+	return err
+}
+
+// RestoreBackup rolls back an in-place conversion of dir and returns the number of files
+// restored. Files are restored from archive if it is set, otherwise from the latest archive in
+// the backup directory, or else from the .bak copies next to them, which are removed.
+func RestoreBackup(dir, archive string) (int, error) {
+	if archive == "" {
+		archives, _ := filepath.Glob(filepath.Join(dir, BackupDir, "*.tar.gz"))
+		if len(archives) > 0 {
+			sort.Slice(archives, func(i, j int) bool { return archiveBefore(archives[i], archives[j]) })
+			archive = archives[len(archives)-1]
+		}
+	}
+	if archive != "" {
+		return restoreArchive(dir, archive)
+	}
+	return restoreBakFiles(dir)
+}
+
+// archiveBefore reports whether the backup archive a was written before b, by their time stamp
+// and then by the suffix of archives written in the same second
+func archiveBefore(a, b string) bool {
+	aStamp, aSeq := archiveStamp(a)
+	bStamp, bSeq := archiveStamp(b)
+	if aStamp != bStamp {
+		return aStamp < bStamp
+	}
+	return aSeq < bSeq
+}
+
+// archiveStamp splits the name of a backup archive into its time stamp and sequence suffix
+func archiveStamp(path string) (string, int) {
+	name := strings.TrimSuffix(filepath.Base(path), ".tar.gz")
+	if n := len(backupStampLayout); len(name) > n+1 && name[n] == '-' {
+		if seq, err := strconv.Atoi(name[n+1:]); err == nil {
+			return name[:n], seq
+		}
+	}
+	return name, 0
+}
+
+// restoreArchive extracts a backup archive over dir
+func restoreArchive(dir, archive string) (int, error) {
+	in, err := os.Open(archive)
+	if err != nil {
+		return 0, fmt.Errorf("opening backup archive: %w", err)
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return 0, fmt.Errorf("reading backup archive %s: %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+
+	count := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("reading backup archive %s: %w", archive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return count, fmt.Errorf("backup archive %s: invalid entry %s", archive, header.Name)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return count, err
+		}
+		err = writeAtomic(context.Background(), path, func(w io.Writer) error {
+			_, err := io.Copy(w, tr)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("restoring %s: %w", header.Name, err)
+		}
+		if err := os.Chtimes(path, header.ModTime, header.ModTime); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// restoreBakFiles moves the .bak copies that h2h made under dir back over the files they were
+// made from, leaving other .bak files alone
+func restoreBakFiles(dir string) (int, error) {
+	baks, err := readBakList(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(baks) == 0 {
+		return 0, fmt.Errorf("%w in %s", ErrNoBackup, dir)
+	}
+
+	count := 0
+	for i, name := range baks {
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return count, fmt.Errorf("backup list: invalid entry %s", name)
+		}
+		bak := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.Rename(bak, strings.TrimSuffix(bak, BackupSuffix))
+		if os.IsNotExist(err) {
+			continue // Removed by hand since
+		}
+		if err != nil {
+			writeBakList(context.Background(), dir, baks[i:])
+			return count, fmt.Errorf("restoring %s: %w", bak, err)
+		}
+		count++
+	}
+	return count, writeBakList(context.Background(), dir, nil)
+}
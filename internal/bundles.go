@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// markdownRefPattern matches a Markdown image or link such as ![alt](a.png "title")
+var markdownRefPattern = regexp.MustCompile(`(!?)\[([^\]\n]*)\]\(([^)\s]+)(?:\s+"([^"\n]*)")?\)`)
+
+// assetTagPattern matches Hexo's asset tags, such as {% asset_img a.png %}
+var assetTagPattern = regexp.MustCompile(`\{%-?\s*asset_(?:img|link|path)\s[^%\n]*%\}`)
+
+// bundleFolder returns the name of the folder a post is paired with when bundles are enabled:
+// in hexo2hugo, the post asset folder foo/ next to foo.md; in hugo2hexo, the leaf bundle
+// foo/ holding foo/index.md. It returns an empty string for posts without such a folder.
+func (fp *FileProcessor) bundleFolder(srcPath string) string {
+	if !fp.converter.bundles {
+		return ""
+	}
+
+	base := filepath.Base(srcPath)
+	switch fp.converter.fmc.direction {
+	case DirectionHexoToHugo:
+		if base == "index"+fp.fileExt {
+			return ""
+		}
+		folder := strings.TrimSuffix(base, fp.fileExt)
+		if info, err := os.Stat(filepath.Join(filepath.Dir(srcPath), folder)); err == nil && info.IsDir() {
+			return folder
+		}
+	case DirectionHugoToHexo:
+		dir := filepath.Dir(srcPath)
+		if base == "index"+fp.fileExt && filepath.Clean(dir) != filepath.Clean(fp.srcDir) {
+			return filepath.Base(dir)
+		}
+	}
+	return ""
+}
+
+// targetPath returns where a post that would be written to dstPath is written instead when it
+// is paired with a folder: foo.md becomes foo/index.md in hexo2hugo, and the reverse in hugo2hexo.
+// The folder's other files keep their paths, so they end up next to the post either way.
+func (fp *FileProcessor) targetPath(srcPath, dstPath string) string {
+	if fp.bundleFolder(srcPath) == "" {
+		return dstPath
+	}
+	if fp.converter.fmc.direction == DirectionHugoToHexo {
+		return filepath.Dir(dstPath) + fp.fileExt
+	}
+	return filepath.Join(strings.TrimSuffix(dstPath, fp.fileExt), "index"+fp.fileExt)
+}
+
+// rewriteBundleRefs rewrites the relative asset references in the body of a post that moves
+// into or out of the folder named folder. In hexo2hugo, references such as folder/a.png lose
+// their folder, as the post now sits inside it. In hugo2hexo, relative images become
+// {% asset_img %} tags, which Hexo resolves against the post asset folder.
+func rewriteBundleRefs(body, folder string, direction Direction) string {
+	fences := codeFenceRanges(body)
+	replace := func(pattern *regexp.Regexp, fn func(m []string) string) {
+		var out strings.Builder
+		last := 0
+		for _, m := range pattern.FindAllStringSubmatchIndex(body, -1) {
+			if inRanges(fences, m[0]) {
+				continue
+			}
+			groups := make([]string, len(m)/2)
+			for i := range groups {
+				if m[2*i] >= 0 {
+					groups[i] = body[m[2*i]:m[2*i+1]]
+				}
+			}
+			out.WriteString(body[last:m[0]])
+			out.WriteString(fn(groups))
+			last = m[1]
+		}
+		out.WriteString(body[last:])
+		body = out.String()
+		fences = codeFenceRanges(body)
+	}
+
+	if direction == DirectionHugoToHexo {
+		replace(markdownRefPattern, func(m []string) string {
+			if m[1] != "!" || !isRelativeRef(m[3]) {
+				return m[0]
+			}
+			tag := "{% asset_img " + strings.TrimPrefix(m[3], "./")
+			if m[4] != "" {
+				tag += " " + quoteTagArg(m[4]) + " " + quoteTagArg(m[2])
+			} else if m[2] != "" {
+				tag += " " + quoteTagArg(m[2])
+			}
+			return tag + " %}"
+		})
+		return body
+	}
+
+	trimFolder := func(ref string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(ref, "./"), folder+"/")
+	}
+	replace(markdownRefPattern, func(m []string) string {
+		if !isRelativeRef(m[3]) {
+			return m[0]
+		}
+		return strings.Replace(m[0], "("+m[3], "("+trimFolder(m[3]), 1)
+	})
+	folderArg := regexp.MustCompile(`(\s)(?:\./)?` + regexp.QuoteMeta(folder) + `/`)
+	replace(assetTagPattern, func(m []string) string {
+		return folderArg.ReplaceAllString(m[0], "$1")
+	})
+	return body
+}
+
+// isRelativeRef reports whether a Markdown reference points at a file relative to the post
+func isRelativeRef(ref string) bool {
+	return ref != "" && !strings.Contains(ref, ":") && !strings.HasPrefix(ref, "/") &&
+		!strings.HasPrefix(ref, "#") && !strings.HasPrefix(ref, "../")
+}
+
+// quoteTagArg quotes a Hexo tag argument that contains spaces
+func quoteTagArg(arg string) string {
+	if strings.ContainsAny(arg, " \t") {
+		return fmt.Sprintf("%q", arg)
+	}
+	return arg
+}
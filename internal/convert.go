@@ -4,15 +4,19 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"golang.org/x/sync/errgroup"
@@ -32,6 +36,8 @@ const (
 
 	FormatYAML Format = "yaml"
 	FormatTOML Format = "toml"
+	FormatJSON Format = "json"
+	FormatAuto Format = "auto" // Detect the source format of each file from its opening delimiter
 
 	DefaultFileExtension = ".md"
 	FrontMatterDelimiter = "---"
@@ -50,22 +56,84 @@ type Config struct {
 	FileExtension       string
 	MaxConcurrency      int
 	ConversionDirection Direction
+	JSONIndent          int      // Spaces per indentation level in JSON output, 0 for compact output
+	JSONFenced          bool     // Fence JSON output with ";;;" as Hexo allows
+	KeyOrder            []string // Keys written first in TOML and JSON output; the rest keep their source order
+	KeyMappings         []MappingRule
+	ReplaceKeyMappings  bool                  // Use only KeyMappings instead of merging them with the built-in mappings
+	Timezone            *time.Location        // Time zone of dates without an offset, nil to leave dates alone
+	ConvertTags         bool                  // Rewrite Hexo tag plugins or Hugo shortcodes in the Markdown body
+	Draft               bool                  // Mark every converted post as a draft
+	OldPermalink        string                // Hexo permalink pattern of the source site; when set, old URLs are added to aliases
+	NewPermalink        string                // Hugo permalink pattern of the converted posts, for redirect maps
+	RedirectFile        string                // File to write a redirect map from old to new URLs to, if set
+	RedirectFormat      RedirectFormat        // Format of the redirect map, inferred from RedirectFile if empty
+	AssetMode           AssetMode             // How files other than posts are placed in the destination
+	AssetInclude        []string              // Globs of the assets to place; all assets if empty
+	AssetExclude        []string              // Globs of the assets to leave out
+	AssetUnchanged      UnchangedCheck        // How copied assets already in the destination are recognised as unchanged
+	Bundles             bool                  // Restructure Hexo post asset folders as Hugo page bundles, or the reverse
+	DryRun              bool                  // Report what would be written without writing anything
+	Diff                bool                  // Include a unified diff of each post in the dry run report
+	InPlace             bool                  // Rewrite the posts under the source directory instead of writing a destination
+	Backup              BackupMode            // How an in-place conversion backs up the posts it rewrites
+	Incremental         bool                  // Skip posts that are unchanged since the last run, as recorded in a manifest
+	ManifestFile        string                // Manifest of an incremental conversion, DefaultManifestFile in the destination if empty
+	Force               bool                  // Overwrite outputs edited by hand since the last incremental run
+	Prune               bool                  // Remove the outputs of posts whose source was deleted since the last incremental run
+	OnFile              func(file FileReport) // Called with each file as soon as it is done, if set
+	Logger              *slog.Logger          // Receives the events of each file; nothing is logged if nil
+	PollInterval        time.Duration         // How often watch mode scans the source directory for changes
+	Debounce            time.Duration         // How long a changed file must stay unchanged before watch mode converts it
 }
 
 // ConversionError wraps errors that occur during conversion
 type ConversionError struct {
 	SourceFile string
+	Line       int // Line of a malformed front matter block, 0 if not applicable
 	Err        error
 }
 
-// FormatHandler interface for handling different front matter formats
+// Warning is a problem found in a file that did not stop its conversion
+type Warning struct {
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// FileResult describes the conversion of a single file
+type FileResult struct {
+	Format   Format      // Source front matter format the file was read as
+	Warnings []Warning   // Problems that did not stop the conversion
+	OldURL   string      // URL of the post on the source site, if OldPermalink is set
+	NewURL   string      // URL of the post on the converted site, if it could be computed
+	Renamed  []KeyRename // Front matter keys moved by mapping rules
+	Added    []string    // Front matter keys the conversion added, as dotted paths
+	Removed  []string    // Front matter keys the conversion removed, as dotted paths
+	Diff     string      // Unified diff of the file, computed by PlanFile on request
+}
+
+// FormatHandler interface for handling different front matter formats.
+// Besides plain Go values, handlers accept a *yaml.Node, which keeps key order.
 type FormatHandler interface {
 	Unmarshal(data []byte, v interface{}) error
 	Marshal(w io.Writer, v interface{}) error
 }
 
+// newConversionError wraps an error converting src, with the line of a malformed front matter block
+func newConversionError(src string, err error) *ConversionError {
+	convErr := &ConversionError{SourceFile: src, Err: err}
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		convErr.Line = parseErr.Line
+	}
+	return convErr
+}
+
 // Error returns the error string
 func (e *ConversionError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("converting file %s:%d: %v", e.SourceFile, e.Line, e.Err)
+	}
 	return fmt.Sprintf("converting file %s: %v", e.SourceFile, e.Err)
 }
 
@@ -78,7 +146,15 @@ func (e *ConversionError) Unwrap() error {
 type YAMLHandler struct{}
 
 // TOMLHandler implements FormatHandler for TOML
-type TOMLHandler struct{}
+type TOMLHandler struct {
+	KeyOrder []string // Top-level keys of a *yaml.Node written first, in order
+}
+
+// JSONHandler implements FormatHandler for JSON
+type JSONHandler struct {
+	Indent   string   // Indentation per level, empty for compact output
+	KeyOrder []string // Top-level keys written first, in order
+}
 
 // Unmarshal parses YAML data
 func (h YAMLHandler) Unmarshal(data []byte, v interface{}) error {
@@ -95,31 +171,153 @@ func (h YAMLHandler) Marshal(w io.Writer, v interface{}) error {
 
 // Unmarshal parses TOML data
 func (h TOMLHandler) Unmarshal(data []byte, v interface{}) error {
+	if node, ok := v.(*yaml.Node); ok {
+		return decodeTOMLNode(data, node)
+	}
 	return toml.Unmarshal(data, v)
 }
 
 // Marshal serializes data to TOML
 func (h TOMLHandler) Marshal(w io.Writer, v interface{}) error {
+	if node, ok := v.(*yaml.Node); ok {
+		return encodeTOMLNode(w, node, h.KeyOrder)
+	}
 	return toml.NewEncoder(w).Encode(v)
 }
 
+// Unmarshal parses JSON data, decoding integral numbers as int64 and others as float64
+func (h JSONHandler) Unmarshal(data []byte, v interface{}) error {
+	if node, ok := v.(*yaml.Node); ok {
+		return decodeJSONNode(data, node)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if m, ok := v.(*map[string]interface{}); ok {
+		for key, value := range *m {
+			(*m)[key] = normalizeJSONNumbers(value)
+		}
+	}
+	return nil
+}
+
+// Marshal serializes data to JSON. Top-level keys listed in KeyOrder come first, followed by
+// the remaining keys in their original order for a *yaml.Node or in alphabetical order for a map.
+func (h JSONHandler) Marshal(w io.Writer, v interface{}) error {
+	if node, ok := v.(*yaml.Node); ok {
+		return encodeJSONNode(w, node, h)
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return h.encode(w, v, "")
+	}
+
+	keys := orderKeys(m, h.KeyOrder)
+	newline, separator := "", ":"
+	if h.Indent != "" {
+		newline, separator = "\n", ": "
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{" + newline)
+	for i, key := range keys {
+		buf.WriteString(h.Indent)
+		if err := h.encode(&buf, key, ""); err != nil {
+			return err
+		}
+		buf.WriteString(separator)
+		if err := h.encode(&buf, m[key], h.Indent); err != nil {
+			return err
+		}
+		if i < len(keys)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(newline)
+	}
+	buf.WriteString("}\n")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// encode writes a single JSON value without HTML escaping or a trailing newline
+func (h JSONHandler) encode(buf io.Writer, v interface{}, prefix string) error {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent(prefix, h.Indent)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := buf.Write(bytes.TrimSuffix(out.Bytes(), []byte("\n")))
+	return err
+}
+
+// normalizeJSONNumbers replaces json.Number values with int64 or float64
+func normalizeJSONNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = normalizeJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeJSONNumbers(item)
+		}
+	}
+	return v
+}
+
+// orderKeys returns the keys of m with those in priority first, in order, and the rest sorted
+func orderKeys(m map[string]interface{}, priority []string) []string {
+	keys := make([]string, 0, len(m))
+	seen := make(map[string]bool, len(priority))
+	for _, key := range priority {
+		if _, ok := m[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	rest := make([]string, 0, len(m)-len(keys))
+	for key := range m {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
 // Pre-initialized format handlers and key mappings
 var (
 	formatHandlers = map[Format]FormatHandler{
 		FormatYAML: YAMLHandler{},
 		FormatTOML: TOMLHandler{},
+		FormatJSON: JSONHandler{},
 	}
 
-	keyMappings = map[Direction]map[string]string{
+	// Hexo ranks a higher sticky first while Hugo sorts a lower weight first, so the value is negated
+	keyMappings = map[Direction][]MappingRule{
 		DirectionHexoToHugo: {
-			"permalink": "slug",
-			"updated":   "lastmod",
-			"sticky":    "weight",
+			{From: "permalink", To: StringList{"slug"}, Transform: StringList{TransformLastSegment}},
+			{From: "updated", To: StringList{"lastmod"}},
+			{From: "sticky", To: StringList{"weight"}, Transform: StringList{TransformNegate}},
 		},
 		DirectionHugoToHexo: {
-			"slug":    "permalink",
-			"lastmod": "updated",
-			"weight":  "sticky",
+			{From: "slug", To: StringList{"permalink"}},
+			{From: "lastmod", To: StringList{"updated"}},
+			{From: "weight", To: StringList{"sticky"}, Transform: StringList{TransformNegate}},
 		},
 	}
 )
@@ -132,75 +330,179 @@ func NewDefaultConfig() *Config {
 		FileExtension:       DefaultFileExtension,
 		MaxConcurrency:      runtime.NumCPU(),
 		ConversionDirection: DirectionHexoToHugo,
+		JSONIndent:          4,
+		KeyOrder:            []string{"title", "date", "draft"},
+		ConvertTags:         true,
+		NewPermalink:        DefaultNewPermalink,
+		AssetMode:           AssetNone,
+		AssetUnchanged:      UnchangedMtime,
+		PollInterval:        DefaultPollInterval,
+		Debounce:            DefaultDebounce,
+	}
+}
+
+// handlerFor returns the FormatHandler for format, configured with the output options in cfg
+func handlerFor(format Format, cfg *Config) (FormatHandler, error) {
+	handler, ok := formatHandlers[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	switch h := handler.(type) {
+	case TOMLHandler:
+		h.KeyOrder = cfg.KeyOrder
+		handler = h
+	case JSONHandler:
+		h.Indent = strings.Repeat(" ", cfg.JSONIndent)
+		h.KeyOrder = cfg.KeyOrder
+		handler = h
 	}
+	return handler, nil
 }
 
 // FrontMatterConverter handles front matter conversion
 type FrontMatterConverter struct {
-	keyMap        map[string]string
-	sourceFormat  Format
-	targetFormat  Format
-	sourceHandler FormatHandler
-	targetHandler FormatHandler
+	rules           []compiledRule
+	direction       Direction
+	timezone        *time.Location
+	draft           bool
+	oldPermalink    string
+	newPermalink    string
+	sourceFormat    Format
+	targetFormat    Format
+	targetHandler   FormatHandler
+	targetDelimiter string
 }
 
 // NewFrontMatterConverter creates a new FrontMatterConverter
 func NewFrontMatterConverter(cfg *Config) (*FrontMatterConverter, error) {
-	sourceHandler, ok := formatHandlers[cfg.SourceFormat]
-	if !ok {
+	if _, ok := formatHandlers[cfg.SourceFormat]; !ok && cfg.SourceFormat != FormatAuto {
 		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, cfg.SourceFormat)
 	}
 
-	targetHandler, ok := formatHandlers[cfg.TargetFormat]
-	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, cfg.TargetFormat)
+	targetHandler, err := handlerFor(cfg.TargetFormat, cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	keyMap := keyMappings[cfg.ConversionDirection]
-	if keyMap == nil {
-		keyMap = make(map[string]string)
+	targetDelimiter := frontMatterDelimiters[cfg.TargetFormat]
+	if cfg.TargetFormat == FormatJSON && cfg.JSONFenced {
+		targetDelimiter = JSONDelimiter
+	}
+
+	rules, err := mappingRules(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	return &FrontMatterConverter{
-		keyMap:        keyMap,
-		sourceFormat:  cfg.SourceFormat,
-		targetFormat:  cfg.TargetFormat,
-		sourceHandler: sourceHandler,
-		targetHandler: targetHandler,
+		rules:           rules,
+		direction:       cfg.ConversionDirection,
+		timezone:        cfg.Timezone,
+		draft:           cfg.Draft,
+		oldPermalink:    cfg.OldPermalink,
+		newPermalink:    cfg.NewPermalink,
+		sourceFormat:    cfg.SourceFormat,
+		targetFormat:    cfg.TargetFormat,
+		targetHandler:   targetHandler,
+		targetDelimiter: targetDelimiter,
 	}, nil
 }
 
 // ConvertFrontMatter converts front matter between formats
 func (fmc *FrontMatterConverter) ConvertFrontMatter(frontMatter string) (string, error) {
-	frontMatterMap := make(map[string]interface{})
+	return fmc.ConvertFrontMatterFrom(fmc.sourceFormat, frontMatter)
+}
+
+// ConvertFrontMatterFrom converts front matter written in the given source format
+func (fmc *FrontMatterConverter) ConvertFrontMatterFrom(sourceFormat Format, frontMatter string) (string, error) {
+	return fmc.convertFrontMatter(sourceFormat, frontMatter, "", &FileResult{})
+}
+
+// convertFrontMatter converts front matter written in the given source format. name is the path
+// of the post relative to its posts directory, used to compute its old and new URLs into result.
+// The keys the conversion renamed, added and removed are recorded in result as well.
+func (fmc *FrontMatterConverter) convertFrontMatter(sourceFormat Format, frontMatter, name string, result *FileResult) (string, error) {
+	sourceHandler, ok := formatHandlers[sourceFormat]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, sourceFormat)
+	}
 
-	// Parse source format
-	if err := fmc.sourceHandler.Unmarshal([]byte(frontMatter), &frontMatterMap); err != nil {
-		return "", fmt.Errorf("unmarshaling front matter: %w", err)
+	// Parse source format, keeping key order and comments
+	var doc yaml.Node
+	if err := sourceHandler.Unmarshal([]byte(frontMatter), &doc); err != nil {
+		return "", &ParseError{Line: errorLine(err, frontMatter), Err: fmt.Errorf("unmarshaling front matter: %w", err)}
+	}
+	mapping, err := frontMatterMapping(&doc)
+	if err != nil {
+		return "", &ParseError{Err: err}
+	}
+
+	// The old URL is computed from the source keys, before they are mapped
+	aliases := fmc.oldPermalink != "" && name != "" && fmc.direction == DirectionHexoToHugo
+	if aliases {
+		if result.OldURL, err = oldPostURL(mapping, name, fmc.oldPermalink, fmc.timezone); err != nil {
+			result.Warnings = append(result.Warnings, Warning{Line: 1, Message: fmt.Sprintf("cannot compute old URL: %v", err)})
+			aliases = false
+		}
 	}
 
 	// Apply key mappings
-	convertedMap := make(map[string]interface{}, len(frontMatterMap))
-	for key, value := range frontMatterMap {
-		targetKey := key
-		if mapped, ok := fmc.keyMap[key]; ok {
-			targetKey = mapped
+	before, renames := leafKeyPaths(mapping), matchedRenames(mapping, fmc.rules)
+	warnings, err := applyMappingRules(mapping, fmc.rules)
+	if err != nil {
+		return "", fmt.Errorf("mapping keys: %w", err)
+	}
+	for _, warning := range warnings {
+		result.Warnings = append(result.Warnings, Warning{Line: 1, Message: warning})
+	}
+
+	if fmc.draft {
+		if err := setPath(mapping, keyPath{{key: "draft", index: -1}}, nil, scalarNode(tagBool, "true")); err != nil {
+			return "", err
 		}
-		convertedMap[targetKey] = value
+	}
+
+	// Give dates an explicit offset for Hugo, or local time for Hexo
+	if err := normalizeDates(mapping, fmc.timezone, fmc.direction); err != nil {
+		return "", fmt.Errorf("normalizing dates: %w", err)
+	}
+
+	if aliases {
+		if result.NewURL, err = newPostURL(mapping, name, fmc.newPermalink, fmc.timezone); err != nil {
+			result.Warnings = append(result.Warnings, Warning{Line: 1, Message: fmt.Sprintf("cannot compute new URL: %v", err)})
+		}
+		if result.OldURL != result.NewURL {
+			addAlias(mapping, result.OldURL)
+		}
+	}
+
+	recordKeyChanges(result, before, mapping, renames)
+
+	// Keep an empty block empty rather than serializing an empty map
+	if fmc.targetDelimiter != "" && len(mapping.Content) == 0 {
+		return wrapFrontMatter(fmc.targetDelimiter, ""), nil
 	}
 
 	// Convert to target format
 	var buf bytes.Buffer
-	if err := fmc.targetHandler.Marshal(&buf, convertedMap); err != nil {
+	if err := fmc.targetHandler.Marshal(&buf, &doc); err != nil {
 		return "", fmt.Errorf("marshaling front matter: %w", err)
 	}
 
-	return fmt.Sprintf("%s\n%s%s", FrontMatterDelimiter, buf.String(), FrontMatterDelimiter), nil
+	data := buf.String()
+	if fmc.targetFormat == FormatJSON && fmc.targetDelimiter != "" {
+		data = unwrapJSONObject(data)
+	}
+	return wrapFrontMatter(fmc.targetDelimiter, data), nil
 }
 
 // MarkdownConverter handles Markdown file conversion
 type MarkdownConverter struct {
-	fmc *FrontMatterConverter
+	fmc         *FrontMatterConverter
+	convertBody func(body string, startLine int) (string, []Warning) // Nil to copy the body verbatim
+	bundles     bool                                                 // Restructure posts paired with a folder
+	logger      *slog.Logger
 }
 
 // NewMarkdownConverter creates a new MarkdownConverter
@@ -209,41 +511,90 @@ func NewMarkdownConverter(cfg *Config) (*MarkdownConverter, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &MarkdownConverter{fmc: fmc}, nil
+	mc := &MarkdownConverter{fmc: fmc, bundles: cfg.Bundles, logger: loggerFor(cfg)}
+	if cfg.ConvertTags {
+		switch cfg.ConversionDirection {
+		case DirectionHexoToHugo:
+			mc.convertBody = convertHexoTags
+		case DirectionHugoToHexo:
+			mc.convertBody = convertHugoShortcodes
+		}
+	}
+	return mc, nil
 }
 
-// ConvertMarkdown converts a single Markdown file
-func (mc *MarkdownConverter) ConvertMarkdown(r io.Reader, w io.Writer) error {
+// ConvertMarkdown converts a single Markdown file and reports the source format it was read as
+func (mc *MarkdownConverter) ConvertMarkdown(r io.Reader, w io.Writer) (FileResult, error) {
+	return mc.convertMarkdown(r, w, "", "")
+}
+
+// convertMarkdown converts a single Markdown file. name is the path of the post relative to
+// its posts directory, or empty if unknown. bundle is the name of the folder the post moves
+// into or out of, or empty if it keeps its place.
+func (mc *MarkdownConverter) convertMarkdown(r io.Reader, w io.Writer, name, bundle string) (FileResult, error) {
+	var result FileResult
 	var buf bytes.Buffer
 	if _, err := buf.ReadFrom(r); err != nil {
-		return fmt.Errorf("reading content: %w", err)
+		return result, fmt.Errorf("reading content: %w", err)
 	}
-
 	content := buf.String()
-	parts := strings.SplitN(content, FrontMatterDelimiter, 3)
-	if len(parts) < 3 {
-		return ErrInvalidMarkdown
+
+	result.Format = mc.fmc.sourceFormat
+	if result.Format == FormatAuto {
+		if result.Format = detectFormat(content); result.Format == "" {
+			return result, ErrInvalidMarkdown
+		}
+	}
+
+	block, err := scanFrontMatter(content, result.Format)
+	if err != nil {
+		return result, err
 	}
 
-	convertedFrontMatter, err := mc.fmc.ConvertFrontMatter(strings.TrimSpace(parts[1]))
+	convertedFrontMatter, err := mc.fmc.convertFrontMatter(result.Format, block.Data, name, &result)
 	if err != nil {
-		return fmt.Errorf("converting front matter: %w", err)
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			parseErr.Line = block.Line + max(parseErr.Line, 1) - 1
+		}
+		return result, fmt.Errorf("converting front matter: %w", err)
+	}
+
+	body := block.Body
+	if mc.convertBody != nil {
+		bodyLine := strings.Count(content[:len(content)-len(body)], "\n") + 1
+		body = strings.ReplaceAll(body, "\r\n", "\n")
+		var warnings []Warning
+		body, warnings = mc.convertBody(body, bodyLine)
+		result.Warnings = append(result.Warnings, warnings...)
+		if block.CRLF {
+			body = strings.ReplaceAll(body, "\n", "\r\n")
+		}
+	}
+	if bundle != "" {
+		body = rewriteBundleRefs(body, bundle, mc.fmc.direction)
+	}
+
+	newline := "\n"
+	if block.CRLF {
+		convertedFrontMatter = strings.ReplaceAll(convertedFrontMatter, "\n", "\r\n")
+		newline = "\r\n"
 	}
 
 	writer := bufio.NewWriter(w)
 	if _, err := writer.WriteString(convertedFrontMatter); err != nil {
-		return err
+		return result, err
 	}
 
-	if _, err := writer.WriteString("\n\n"); err != nil {
-		return err
+	if _, err := writer.WriteString(newline); err != nil {
+		return result, err
 	}
 
-	if _, err := writer.WriteString(parts[2]); err != nil {
-		return err
+	if _, err := writer.WriteString(body); err != nil {
+		return result, err
 	}
 
-	return writer.Flush()
+	return result, writer.Flush()
 }
 
 // FileProcessor encapsulates logic for processing a single file
@@ -264,94 +615,115 @@ func NewFileProcessor(converter *MarkdownConverter, srcDir, dstDir, fileExt stri
 	}
 }
 
-// ProcessFile processes a single file conversion
-func (fp *FileProcessor) ProcessFile(ctx context.Context, path string) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-	}
-
+// ProcessFile processes a single file conversion and reports the source format it was read as
+func (fp *FileProcessor) ProcessFile(ctx context.Context, path string) (FileResult, error) {
 	// Skip non-matching files
 	if !strings.HasSuffix(path, fp.fileExt) {
-		return nil
+		return FileResult{}, nil
 	}
 
 	// Determine target path
 	relPath, err := filepath.Rel(fp.srcDir, path)
 	if err != nil {
-		return fmt.Errorf("getting relative path: %w", err)
+		return FileResult{}, fmt.Errorf("getting relative path: %w", err)
+	}
+	return fp.ConvertFile(ctx, path, fp.targetPath(path, filepath.Join(fp.dstDir, relPath)))
+}
+
+// ConvertFile converts the Markdown file at srcPath and writes the result to dstPath. When
+// bundles are enabled, the body's references to the post's folder are rewritten for dstPath.
+func (fp *FileProcessor) ConvertFile(ctx context.Context, srcPath, dstPath string) (FileResult, error) {
+	select {
+	case <-ctx.Done():
+		return FileResult{}, ctx.Err()
+	default:
 	}
-	dstPath := filepath.Join(fp.dstDir, relPath)
 
 	// Ensure target directory exists
 	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-		return fmt.Errorf("creating destination directory: %w", err)
+		return FileResult{}, fmt.Errorf("creating destination directory: %w", err)
 	}
 
 	// Open source file
-	srcFile, err := os.Open(path)
+	srcFile, err := os.Open(srcPath)
 	if err != nil {
-		return fmt.Errorf("opening source file: %w", err)
+		return FileResult{}, fmt.Errorf("opening source file: %w", err)
 	}
 	defer srcFile.Close()
 
-	// Create target file
-	dstFile, err := os.Create(dstPath)
+	// Name the post by its path below the source directory, which its old URL may contain
+	name, err := filepath.Rel(fp.srcDir, srcPath)
 	if err != nil {
-		return fmt.Errorf("creating destination file: %w", err)
+		return FileResult{}, fmt.Errorf("getting relative path: %w", err)
 	}
-	defer func() {
-		dstFile.Close()
-		if err != nil {
-			os.Remove(dstPath)
-		}
-	}()
-
-	// Convert content
-	bufWriter := bufio.NewWriter(dstFile)
-	err = fp.converter.ConvertMarkdown(srcFile, bufWriter)
-	if err != nil {
+	name = filepath.ToSlash(name)
+
+	// Convert into a temporary file that replaces dstPath only once the conversion is complete,
+	// so a failed or cancelled conversion leaves nothing behind, and a file converted in place
+	// is not truncated while it is being read
+	var result FileResult
+	err = writeAtomic(ctx, dstPath, func(w io.Writer) error {
+		var err error
+		result, err = fp.converter.convertMarkdown(contextReader{ctx, srcFile}, w, name, fp.bundleFolder(srcPath))
 		return err
+	})
+	logger := fileLogger(ctx, fp.converter.logger, srcPath)
+	logResult(logger, result)
+	if err == nil {
+		logger.Debug("wrote file", "path", dstPath)
 	}
-	return bufWriter.Flush()
+	return result, err
+}
+
+// conversionJob is a single file to convert or place as an asset
+type conversionJob struct {
+	src       string
+	dst       string
+	processor *FileProcessor // Nil to place the file unchanged
+	mode      AssetMode      // How the file is placed if it is not converted
 }
 
-// ConvertPosts converts all Markdown posts in the source directory to the target format
-func ConvertPosts(srcDir, dstDir string, cfg *Config) error {
+// ConvertPosts converts all Markdown posts in the source directory to the target format and
+// reports what it did with each file. With cfg.InPlace, the posts are rewritten where they are,
+// dstDir is ignored, and assets are left alone. Cancelling ctx stops the conversion; files are
+// only ever replaced by complete conversions. If any file failed, the report is returned along
+// with an error that counts the failures.
+func ConvertPosts(ctx context.Context, srcDir, dstDir string, cfg *Config) (*Report, error) {
 	if cfg == nil {
 		cfg = NewDefaultConfig()
 	}
+	if err := validateAssetOptions(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.InPlace {
+		if cfg.Bundles {
+			return nil, errors.New("bundles cannot be restructured in place")
+		}
+		dstDir = srcDir
+	} else if sameDir(srcDir, dstDir) {
+		return nil, ErrSameDirectory
+	}
+	start := time.Now()
 
 	// Ensure destination directory exists
-	if err := os.MkdirAll(dstDir, 0755); err != nil {
-		return fmt.Errorf("creating destination directory %s: %w", dstDir, err)
+	if !cfg.DryRun {
+		if err := os.MkdirAll(dstDir, 0755); err != nil {
+			return nil, fmt.Errorf("creating destination directory %s: %w", dstDir, err)
+		}
 	}
 
 	// Create converter
 	converter, err := NewMarkdownConverter(cfg)
 	if err != nil {
-		return fmt.Errorf("creating markdown converter: %w", err)
+		return nil, fmt.Errorf("creating markdown converter: %w", err)
 	}
 
 	// Create file processor
 	processor := NewFileProcessor(converter, srcDir, dstDir, cfg.FileExtension)
 
-	// Setup error handling
-	var (
-		mu               sync.Mutex
-		conversionErrors []*ConversionError
-	)
-
-	// Setup errgroup for concurrent processing
-	g, ctx := errgroup.WithContext(context.Background())
-	g.SetLimit(cfg.MaxConcurrency)
-
-	// Track processed files count
-	var fileCount atomic.Int64
-
 	// Collect matching files first to avoid file system bottlenecks
-	var files []string
+	var jobs []conversionJob
+	sources := make(map[string]string)
 	err = filepath.WalkDir(srcDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -361,46 +733,309 @@ func ConvertPosts(srcDir, dstDir string, cfg *Config) error {
 			return nil
 		}
 
-		if strings.HasSuffix(path, cfg.FileExtension) {
-			files = append(files, path)
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		job := conversionJob{src: path, dst: filepath.Join(dstDir, relPath)}
+		switch {
+		case strings.HasSuffix(path, cfg.FileExtension):
+			job.processor = processor
+			job.dst = processor.targetPath(path, job.dst)
+		case cfg.AssetMode != "" && cfg.AssetMode != AssetNone && !cfg.InPlace && includeAsset(filepath.ToSlash(relPath), cfg):
+			job.mode = cfg.AssetMode
+		default:
+			return nil
+		}
+
+		if other, ok := sources[job.dst]; ok {
+			return fmt.Errorf("%s and %s both convert to %s", other, path, job.dst)
 		}
+		sources[job.dst] = path
+		jobs = append(jobs, job)
 		return nil
 	})
 
 	if err != nil {
-		return fmt.Errorf("walking source directory %s: %w", srcDir, err)
+		return nil, fmt.Errorf("walking source directory %s: %w", srcDir, err)
+	}
+
+	report := &Report{SrcDir: srcDir, DstDir: dstDir, DryRun: cfg.DryRun}
+	defer func() { report.Duration = time.Since(start) }()
+
+	// Leave out the posts that are unchanged since the last run
+	var run *incrementalRun
+	if cfg.Incremental {
+		if run, jobs, err = startIncremental(srcDir, dstDir, jobs, cfg); err != nil {
+			return nil, err
+		}
+		notifyFiles(cfg, run.skipped)
+	}
+
+	// Back up the posts before any of them is rewritten
+	if cfg.InPlace && !cfg.DryRun {
+		files := make([]string, len(jobs))
+		for i, job := range jobs {
+			files[i] = job.src
+		}
+		if report.Backup, err = backupFiles(ctx, srcDir, files, cfg.Backup); err != nil {
+			return nil, err
+		}
+	}
+
+	if run == nil {
+		return report, runJobs(ctx, jobs, cfg, report, nil, nil)
 	}
+	var record func(job conversionJob, result FileResult) error
+	if !cfg.DryRun {
+		record = run.record
+	}
+	err = runJobs(ctx, jobs, cfg, report, run.urls, record)
+	report.Files = append(report.Files, run.skipped...)
+	if !cfg.DryRun {
+		deleted, finishErr := run.finish(ctx, cfg.Prune)
+		report.Files = append(report.Files, deleted...)
+		notifyFiles(cfg, deleted)
+		if finishErr != nil && err == nil {
+			err = fmt.Errorf("updating manifest: %w", finishErr)
+		}
+	}
+	sort.SliceStable(report.Files, func(i, j int) bool { return report.Files[i].Source < report.Files[j].Source })
+	return report, err
+}
+
+// runJobs converts or copies files concurrently, and adds the outcome of each to report.
+// known holds the URLs of posts that are not among jobs, such as those an incremental run
+// skipped, which are checked for collisions and written to the redirect map along with the
+// converted posts. done, if set, is called with each post that completed; an error it returns
+// is reported as an error of that file. It returns report.Err() once all files are done.
+func runJobs(ctx context.Context, jobs []conversionJob, cfg *Config, report *Report, known map[string]postURLs, done func(job conversionJob, result FileResult) error) error {
+	// Setup error handling
+	var (
+		mu       sync.Mutex
+		fileURLs = make(map[string]postURLs, len(known))
+		files    = make([]FileReport, len(jobs)) // Filled in by job index, so files keep the job order
+	)
+
+	for path, urls := range known {
+		fileURLs[path] = urls
+	}
+
+	// Setup errgroup for concurrent processing
+	g, groupCtx := errgroup.WithContext(ctx)
+	g.SetLimit(cfg.MaxConcurrency)
+	logger := loggerFor(cfg)
+
+	// Track processed files count
+	var fileCount atomic.Int64
 
 	// Process files concurrently
-	for _, path := range files {
-		path := path // Capture loop variable
+	for i, job := range jobs {
+		if ctx.Err() != nil {
+			break // Cancelled, so no more files are started
+		}
+		i, job := i, job // Capture loop variables
 		g.Go(func() error {
-			if err := processor.ProcessFile(ctx, path); err != nil {
+			start := time.Now()
+			jobCtx, log := withFileLogger(groupCtx, logger, job.src)
+			file := FileReport{Source: job.src, Destination: job.dst, Asset: job.mode, Status: StatusConverted}
+			defer func() {
+				if file.Status == "" {
+					return
+				}
+				file.Duration = time.Since(start)
+				if file.Error != nil {
+					log.Error("conversion failed", "code", file.Error.Code(), "error", file.Error.Err)
+				} else {
+					log.Debug("file done", "status", file.Status, "duration", file.Duration)
+				}
+				files[i] = file
+				if cfg.OnFile != nil {
+					mu.Lock()
+					cfg.OnFile(file)
+					mu.Unlock()
+				}
+			}()
+			fail := func(err *ConversionError) {
+				file.Status, file.Error = StatusFailed, err
+			}
+
+			if job.processor == nil && cfg.DryRun {
+				fileCount.Add(1)
+				return nil
+			}
+			if job.processor == nil {
+				transferred, err := transferAsset(jobCtx, job.src, job.dst, job.mode, cfg.AssetUnchanged)
+				if ctx.Err() != nil {
+					file.Status = ""
+					return ctx.Err()
+				}
+				if err != nil {
+					fail(&ConversionError{SourceFile: job.src, Err: err})
+					return nil
+				}
+				if !transferred {
+					file.Status = StatusSkipped
+				} else {
+					log.Debug("placed asset", "path", job.dst, "mode", job.mode)
+				}
+				fileCount.Add(1)
+				return nil
+			}
+
+			var err error
+			if cfg.DryRun {
+				file.FileResult, err = job.processor.PlanFile(jobCtx, job.src, job.dst, cfg.Diff)
+			} else {
+				file.FileResult, err = job.processor.ConvertFile(jobCtx, job.src, job.dst)
+			}
+			if ctx.Err() != nil {
+				file.Status = ""
+				return ctx.Err()
+			}
+			if file.OldURL != "" {
 				mu.Lock()
-				conversionErrors = append(conversionErrors, &ConversionError{SourceFile: path, Err: err})
+				fileURLs[job.src] = postURLs{old: file.OldURL, new: file.NewURL}
 				mu.Unlock()
+			}
+			if err != nil {
+				fail(newConversionError(job.src, err))
 				return nil // Continue processing other files
 			}
+			if done != nil {
+				if err := done(job, file.FileResult); err != nil {
+					fail(&ConversionError{SourceFile: job.src, Err: err})
+					return nil
+				}
+			}
 			fileCount.Add(1)
 			return nil
 		})
 	}
 
-	// Wait for all goroutines to complete
-	if err := g.Wait(); err != nil {
-		return err
+	// Wait for all goroutines to complete, and keep the files that were done
+	waitErr := g.Wait()
+	for _, file := range files {
+		if file.Status == "" {
+			continue
+		}
+		report.Files = append(report.Files, file)
+		if file.Error != nil {
+			report.Errors = append(report.Errors, file.Error)
+		}
+	}
+	if waitErr != nil || ctx.Err() != nil {
+		return fmt.Errorf("conversion stopped after %d files: %w", fileCount.Load(), context.Cause(ctx))
 	}
 
-	// Report results
-	fmt.Printf("Processed %d files\n", fileCount.Load())
+	// Check that old URLs stay unique, and map them to the new ones
+	for _, collision := range urlCollisions(fileURLs) {
+		logger.Error("conversion failed", "file", collision.SourceFile, "code", collision.Code(), "error", collision.Err)
+		report.Errors = append(report.Errors, collision)
+	}
+	if cfg.RedirectFile != "" {
+		redirects := redirectMap(fileURLs)
+		report.Redirects = len(redirects)
+		if !cfg.DryRun {
+			if err := writeRedirects(ctx, cfg.RedirectFile, cfg.RedirectFormat, redirects); err != nil {
+				return fmt.Errorf("writing redirect map: %w", err)
+			}
+		}
+	}
+	return report.Err()
+}
 
-	// Report errors (if any)
-	if len(conversionErrors) > 0 {
-		for _, err := range conversionErrors {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+// sameDir reports whether two paths name the same directory
+func sameDir(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+// copyFile copies the file at src to dst, creating the destination directory. The copy keeps the
+// source's modification time, so it can be recognised as unchanged later.
+func copyFile(ctx context.Context, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("creating destination directory: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening source file: %w", err)
+	}
+	defer in.Close()
+
+	err = writeAtomic(ctx, dst, func(w io.Writer) error {
+		if _, err := io.Copy(w, contextReader{ctx, in}); err != nil {
+			return fmt.Errorf("copying file: %w", err)
 		}
-		return fmt.Errorf("encountered %d errors during conversion", len(conversionErrors))
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("reading source file: %w", err)
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// writeAtomic writes a file by way of a temporary file in the same directory, which is renamed
+// over path once write succeeds, so readers never see a partly written file. The temporary file
+// is removed if write fails or ctx is cancelled. The new file keeps the permissions of the file
+// it replaces.
+func writeAtomic(ctx context.Context, path string, write func(w io.Writer) error) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing file: %w", err)
+	}
 	return nil
 }
+
+// contextReader is a reader that fails once its context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader unless the context is cancelled
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
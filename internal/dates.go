@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TimezoneKey is the front matter key that overrides the configured time zone for a single file
+const TimezoneKey = "timezone"
+
+// hexoDateLayout is the layout Hexo writes dates in, as local time without an offset
+const hexoDateLayout = "2006-01-02 15:04:05"
+
+// ErrInvalidTimezone is returned for time zones that are neither IANA names nor UTC offsets
+var ErrInvalidTimezone = errors.New("invalid time zone")
+
+// dateKeys are the front matter keys whose values are normalised to the conversion time zone
+var dateKeys = []string{"date", "updated", "lastmod", "publishDate", "expiryDate"}
+
+// dateOnlyLayouts are the entries of dateLayouts that carry no time of day
+var dateOnlyLayouts = map[string]bool{
+	"2006-01-02": true,
+	"2006/01/02": true,
+}
+
+// LoadTimezone resolves an IANA time zone name such as Asia/Shanghai, Local, UTC, or a fixed
+// offset such as +08:00. An empty name resolves to nil, which leaves dates alone.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		offset, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTimezone, name)
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone(name, seconds), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimezone, name)
+	}
+	return loc, nil
+}
+
+// normalizeDates rewrites the date keys of a front matter mapping for the conversion direction.
+// Dates without an offset are read in the time zone named by the file's timezone key, which is
+// removed once applied, or else in loc; without either, dates are left alone.
+// Hugo gets RFC 3339 dates with an explicit offset; Hexo gets local times in that time zone.
+// Values that carry no time of day, or are not dates, are left alone.
+func normalizeDates(mapping *yaml.Node, loc *time.Location, direction Direction) error {
+	if _, value, ok := childNode(mapping, pathSegment{key: TimezoneKey, index: -1}); ok && value.Kind == yaml.ScalarNode {
+		override, err := LoadTimezone(value.Value)
+		if err != nil {
+			return err
+		}
+		if override != nil {
+			loc = override
+		}
+		removeChild(mapping, value)
+	}
+	if loc == nil {
+		return nil
+	}
+
+	for _, key := range dateKeys {
+		_, value, ok := childNode(mapping, pathSegment{key: key, index: -1})
+		if !ok || value.Kind != yaml.ScalarNode {
+			continue
+		}
+		t, hasTime, err := parseDateIn(value.Value, loc)
+		if err != nil || !hasTime {
+			continue
+		}
+
+		formatted := t.Format(time.RFC3339)
+		if direction == DirectionHugoToHexo {
+			formatted = t.In(loc).Format(hexoDateLayout)
+		}
+		normalized := dateNode(formatted)
+		normalized.HeadComment, normalized.LineComment, normalized.FootComment = value.HeadComment, value.LineComment, value.FootComment
+		*value = *normalized
+	}
+	return nil
+}
+
+// parseDateIn parses a date string, reading dates without an offset in loc.
+// It also reports whether the value has a time of day.
+func parseDateIn(value string, loc *time.Location) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, !dateOnlyLayouts[layout], nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%w: %q is not a date", ErrTransformValue, value)
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Front matter delimiters
+const (
+	YAMLDelimiter = FrontMatterDelimiter
+	TOMLDelimiter = "+++"
+	JSONDelimiter = ";;;" // Hexo's fence for JSON front matter written without the outer braces
+
+	utf8BOM = "\ufeff"
+)
+
+// frontMatterDelimiters maps a format to the line fencing its front matter block.
+// JSON front matter is unfenced by default; the object's own braces delimit it.
+var frontMatterDelimiters = map[Format]string{
+	FormatYAML: YAMLDelimiter,
+	FormatTOML: TOMLDelimiter,
+}
+
+// errorLinePattern extracts the line number embedded in YAML and TOML error messages
+var errorLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// ParseError reports a malformed front matter block
+type ParseError struct {
+	Line int // Line in the source file, starting at 1
+	Err  error
+}
+
+// Error returns the error string
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("malformed front matter: %v", e.Err)
+}
+
+// Unwrap returns the wrapped error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// frontMatterBlock is a front matter block located at the start of a Markdown file
+type frontMatterBlock struct {
+	Data string // Raw front matter without delimiters, with LF line endings
+	Body string // Content following the closing delimiter line
+	Line int    // Line on which Data begins
+	CRLF bool   // Whether the file uses CRLF line endings
+}
+
+// wrapFrontMatter fences a serialized front matter block with delim, or leaves it unfenced if delim is empty
+func wrapFrontMatter(delim, data string) string {
+	if delim == "" {
+		return strings.TrimRight(data, "\n")
+	}
+	return delim + "\n" + data + delim
+}
+
+// unwrapJSONObject strips the outer braces of a serialized JSON object and dedents its members,
+// producing the body Hexo expects between ";;;" fences
+func unwrapJSONObject(data string) string {
+	data = strings.TrimSpace(data)
+	data = strings.TrimSpace(data[1 : len(data)-1])
+	if data == "" {
+		return ""
+	}
+
+	lines := strings.Split(data, "\n")
+	indent := len(lines[len(lines)-1]) - len(strings.TrimLeft(lines[len(lines)-1], " \t"))
+	for i, line := range lines {
+		if len(line) >= indent && strings.TrimSpace(line[:indent]) == "" {
+			lines[i] = line[indent:]
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// detectFormat sniffs the front matter format from the opening delimiter of content.
+// It returns an empty Format if content does not start with a known delimiter.
+func detectFormat(content string) Format {
+	line, _ := cutLine(strings.TrimPrefix(content, utf8BOM))
+	switch trimLine(line) {
+	case YAMLDelimiter:
+		return FormatYAML
+	case TOMLDelimiter:
+		return FormatTOML
+	case JSONDelimiter:
+		return FormatJSON
+	}
+	if strings.HasPrefix(line, "{") {
+		return FormatJSON
+	}
+	return ""
+}
+
+// scanFrontMatter locates the front matter block of the given format. A delimiter is only
+// recognised on its own line, and the opening one must be the first line of the file
+// (after an optional UTF-8 BOM). Trailing whitespace on delimiter lines is ignored.
+func scanFrontMatter(content string, format Format) (*frontMatterBlock, error) {
+	content = strings.TrimPrefix(content, utf8BOM)
+	if format == FormatJSON {
+		if first, _ := cutLine(content); trimLine(first) != JSONDelimiter {
+			return scanJSONFrontMatter(content)
+		}
+
+		// Hexo's fenced form omits the outer braces
+		block, err := scanFencedFrontMatter(content, JSONDelimiter)
+		if err != nil {
+			return nil, err
+		}
+		block.Data = "{\n" + block.Data + "}\n"
+		block.Line--
+		return block, nil
+	}
+
+	delim, ok := frontMatterDelimiters[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	return scanFencedFrontMatter(content, delim)
+}
+
+// scanFencedFrontMatter locates a front matter block between two delim lines
+func scanFencedFrontMatter(content, delim string) (*frontMatterBlock, error) {
+	line, rest := cutLine(content)
+	if trimLine(line) != delim {
+		return nil, ErrInvalidMarkdown
+	}
+	crlf := strings.HasSuffix(line, "\r")
+
+	var data strings.Builder
+	for rest != "" {
+		line, rest = cutLine(rest)
+		if trimLine(line) == delim {
+			return &frontMatterBlock{Data: data.String(), Body: rest, Line: 2, CRLF: crlf}, nil
+		}
+		data.WriteString(strings.TrimSuffix(line, "\r"))
+		data.WriteByte('\n')
+	}
+	return nil, &ParseError{Line: 1, Err: fmt.Errorf("missing closing %q delimiter", delim)}
+}
+
+// scanJSONFrontMatter locates a JSON object starting on the first line of content
+func scanJSONFrontMatter(content string) (*frontMatterBlock, error) {
+	if !strings.HasPrefix(content, "{") {
+		return nil, ErrInvalidMarkdown
+	}
+	first, _ := cutLine(content)
+	crlf := strings.HasSuffix(first, "\r")
+
+	end := matchingBrace(content)
+	if end < 0 {
+		return nil, &ParseError{Line: 1, Err: errors.New("unterminated JSON object")}
+	}
+
+	tail, body := cutLine(content[end+1:])
+	if trimLine(tail) != "" {
+		line := strings.Count(content[:end], "\n") + 1
+		return nil, &ParseError{Line: line, Err: errors.New("unexpected content after closing brace")}
+	}
+
+	data := strings.ReplaceAll(content[:end+1], "\r\n", "\n") + "\n"
+	return &frontMatterBlock{Data: data, Body: body, Line: 1, CRLF: crlf}, nil
+}
+
+// cutLine splits s after the first line feed. The returned line keeps any trailing carriage return.
+func cutLine(s string) (line, rest string) {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// trimLine strips trailing whitespace, including a carriage return, from a line
+func trimLine(line string) string {
+	return strings.TrimRight(line, " \t\r")
+}
+
+// matchingBrace returns the index of the brace closing the object that s starts with,
+// or -1 if the object is not terminated. Braces inside JSON strings are ignored.
+func matchingBrace(s string) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// errorLine returns the line within data reported by a front matter decoding error, or 0 if unknown
+func errorLine(err error, data string) int {
+	var tomlErr toml.ParseError
+	if errors.As(err, &tomlErr) {
+		return tomlErr.Position.Line
+	}
+
+	var jsonErr *json.SyntaxError
+	if errors.As(err, &jsonErr) && int(jsonErr.Offset) <= len(data) {
+		return strings.Count(data[:jsonErr.Offset], "\n") + 1
+	}
+
+	if m := errorLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		if n, convErr := strconv.Atoi(m[1]); convErr == nil {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pathSegment is one step of a key path: a mapping key, a sequence index, or a numeric
+// segment that is read as an index on sequences and as a key on mappings
+type pathSegment struct {
+	key       string
+	index     int  // Sequence index, -1 if the segment is not numeric
+	bracketed bool // Written as [n], so it always denotes a sequence index
+}
+
+// keyPath addresses a value in a front matter tree, such as cover.image, params.toc or images[0]
+type keyPath []pathSegment
+
+// pathLocation is where a key path resolves within a front matter tree
+type pathLocation struct {
+	containers []*yaml.Node // Mappings and sequences from the root down to the value's parent
+	key        *yaml.Node   // Key node of the value when its parent is a mapping
+	value      *yaml.Node
+}
+
+// parseKeyPath parses a dotted key path. Sequence indexes are written as [n] or as a numeric segment.
+func parseKeyPath(path string) (keyPath, error) {
+	var segments keyPath
+	for _, part := range strings.Split(path, ".") {
+		name, indexes, _ := strings.Cut(part, "[")
+		if name == "" && indexes == "" {
+			return nil, fmt.Errorf("empty segment in key path %q", path)
+		}
+		if name != "" {
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 {
+				index = -1
+			}
+			segments = append(segments, pathSegment{key: name, index: index})
+		}
+		if indexes == "" {
+			continue
+		}
+
+		for _, group := range strings.Split(strings.TrimSuffix(indexes, "]"), "][") {
+			index, err := strconv.Atoi(group)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index %q in key path %q", group, path)
+			}
+			segments = append(segments, pathSegment{key: group, index: index, bracketed: true})
+		}
+	}
+	return segments, nil
+}
+
+// String returns the path in dotted form
+func (p keyPath) String() string {
+	var sb strings.Builder
+	for i, segment := range p {
+		switch {
+		case segment.bracketed:
+			sb.WriteString("[" + segment.key + "]")
+		case i > 0:
+			sb.WriteString("." + segment.key)
+		default:
+			sb.WriteString(segment.key)
+		}
+	}
+	return sb.String()
+}
+
+// isTopLevelKey reports whether the path names a key of the root mapping
+func (p keyPath) isTopLevelKey() bool {
+	return len(p) == 1 && !p[0].bracketed
+}
+
+// lookupPath resolves path against root
+func lookupPath(root *yaml.Node, path keyPath) (*pathLocation, bool) {
+	loc := &pathLocation{value: root}
+	for _, segment := range path {
+		container := resolveAlias(loc.value)
+		key, value, ok := childNode(container, segment)
+		if !ok {
+			return nil, false
+		}
+		loc.containers = append(loc.containers, container)
+		loc.key, loc.value = key, value
+	}
+	return loc, true
+}
+
+// childNode returns the child of node addressed by segment
+func childNode(node *yaml.Node, segment pathSegment) (key, value *yaml.Node, ok bool) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if segment.bracketed {
+			return nil, nil, false
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == segment.key {
+				return node.Content[i], node.Content[i+1], true
+			}
+		}
+	case yaml.SequenceNode:
+		if segment.index >= 0 && segment.index < len(node.Content) {
+			return nil, node.Content[segment.index], true
+		}
+	}
+	return nil, nil, false
+}
+
+// setPath stores value at path under root, creating intermediate mappings and sequences as needed.
+// An existing value at path is replaced. If key is non-nil it is used as the key node of a new pair.
+// Sequences are only appended to, so an index past the end of a sequence is an error.
+func setPath(root *yaml.Node, path keyPath, key, value *yaml.Node) error {
+	node := root
+	for i, segment := range path {
+		last := i == len(path)-1
+		_, child, ok := childNode(node, segment)
+		if !last && ok && isContainer(resolveAlias(child)) {
+			node = resolveAlias(child)
+			continue
+		}
+		if node.Kind == yaml.SequenceNode && segment.index < 0 {
+			return fmt.Errorf("writing %s: %s is not an index of a list", path, segment.key)
+		}
+		if node.Kind == yaml.SequenceNode && segment.index > len(node.Content) {
+			return fmt.Errorf("writing %s: index %d is past the end of the list", path, segment.index)
+		}
+
+		if !last {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if path[i+1].bracketed {
+				child = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			}
+		} else {
+			child = value
+		}
+		putChild(node, segment, key, child, last)
+		node = child
+	}
+	return nil
+}
+
+// putChild stores child in node under segment, replacing any existing child. An index of a
+// sequence must be at most its length.
+func putChild(node *yaml.Node, segment pathSegment, key, child *yaml.Node, last bool) {
+	if node.Kind == yaml.SequenceNode {
+		if segment.index < len(node.Content) {
+			node.Content[segment.index] = child
+		} else {
+			node.Content = append(node.Content, child)
+		}
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == segment.key {
+			node.Content[i+1] = child
+			return
+		}
+	}
+	if !last || key == nil {
+		key = scalarNode(tagString, "")
+	}
+	key.Value = segment.key
+	node.Content = append(node.Content, key, child)
+}
+
+// isContainer reports whether node is a mapping or sequence
+func isContainer(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode
+}
+
+// removeLocation deletes the value at loc from its parent, then removes any ancestors
+// left empty by the deletion. The root mapping itself is never removed.
+func removeLocation(loc *pathLocation) {
+	child := loc.value
+	for i := len(loc.containers) - 1; i >= 0; i-- {
+		container := loc.containers[i]
+		if !removeChild(container, child) || len(container.Content) > 0 || i == 0 {
+			return
+		}
+		child = container
+	}
+}
+
+// removeChild deletes child from node by identity and reports whether it was found
+func removeChild(node, child *yaml.Node) bool {
+	step := 1
+	offset := 0
+	if node.Kind == yaml.MappingNode {
+		step, offset = 2, 1
+	}
+	for i := offset; i < len(node.Content); i += step {
+		if node.Content[i] == child {
+			start := i - offset
+			node.Content = append(node.Content[:start], node.Content[start+step:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+)
+
+// fileLoggerKey is the context key of the logger of the file being converted
+type fileLoggerKey struct{}
+
+// loggerFor returns the logger of cfg, or one that discards everything if it has none
+func loggerFor(cfg *Config) *slog.Logger {
+	if cfg.Logger != nil {
+		return cfg.Logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// withFileLogger derives a logger for the file at src, whose lines share a new correlation ID,
+// and returns a context that carries it
+func withFileLogger(ctx context.Context, logger *slog.Logger, src string) (context.Context, *slog.Logger) {
+	logger = logger.With("correlation_id", newCorrelationID(), "file", src)
+	return context.WithValue(ctx, fileLoggerKey{}, logger), logger
+}
+
+// fileLogger returns the logger of the file carried by ctx, or derives one for the file at src
+// if there is none
+func fileLogger(ctx context.Context, logger *slog.Logger, src string) *slog.Logger {
+	if fileLogger, ok := ctx.Value(fileLoggerKey{}).(*slog.Logger); ok {
+		return fileLogger
+	}
+	_, logger = withFileLogger(ctx, logger, src)
+	return logger
+}
+
+// newCorrelationID returns a random ID that ties together the log lines of one file
+func newCorrelationID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logResult logs what the conversion of a post found: its source format, the keys it moved,
+// added and removed, and its warnings, which mark content that could not be converted faithfully
+func logResult(logger *slog.Logger, result FileResult) {
+	if result.Format != "" {
+		logger.Debug("detected front matter format", "format", result.Format)
+	}
+	for _, rename := range result.Renamed {
+		logger.Debug("renamed key", "from", rename.From, "to", strings.Join(rename.To, ","))
+	}
+	if len(result.Added) > 0 {
+		logger.Debug("added keys", "keys", strings.Join(result.Added, ","))
+	}
+	if len(result.Removed) > 0 {
+		logger.Debug("removed keys", "keys", strings.Join(result.Removed, ","))
+	}
+	for _, warning := range result.Warnings {
+		logger.Warn(warning.Message, "line", warning.Line)
+	}
+}
@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultManifestFile is the name of the manifest of an incremental conversion in the destination
+const DefaultManifestFile = ".h2h-manifest.json"
+
+// manifestVersion is the version of the manifest format; manifests of other versions are ignored
+const manifestVersion = 1
+
+// manifestEntry records the conversion of a single post
+type manifestEntry struct {
+	Source string `json:"source"`            // SHA-256 of the source file
+	Output string `json:"output"`            // SHA-256 of the converted file
+	Dst    string `json:"dst"`               // Path of the converted file relative to the destination
+	OldURL string `json:"old_url,omitempty"` // URL of the post on the source site, if OldPermalink is set
+	NewURL string `json:"new_url,omitempty"`
+}
+
+// manifest records the posts converted by previous incremental runs, keyed by their
+// slash-separated path relative to the source directory
+type manifest struct {
+	Version int                      `json:"version"`
+	Config  string                   `json:"config"` // Hash of the options the posts were converted with
+	Files   map[string]manifestEntry `json:"files"`
+
+	mu sync.Mutex
+}
+
+// incrementalRun is the state of an incremental conversion between planning and recording
+type incrementalRun struct {
+	manifest   *manifest
+	file       string
+	configHash string
+	srcDir     string
+	dstDir     string
+	sourceHash map[string]string   // Source hashes of the posts to convert, by source path
+	skipped    []FileReport        // Posts left out of the conversion
+	urls       map[string]postURLs // Old and new URLs of the skipped posts, by source path
+	logger     *slog.Logger
+}
+
+// loadManifest reads a manifest, returning an empty one if the file does not exist
+func loadManifest(file string) (*manifest, error) {
+	m := &manifest{Version: manifestVersion, Files: make(map[string]manifestEntry)}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var loaded manifest
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", file, err)
+	}
+	if loaded.Version != manifestVersion || loaded.Files == nil {
+		return m, nil
+	}
+	m.Config, m.Files = loaded.Config, loaded.Files
+	return m, nil
+}
+
+// configHash hashes the options that affect the output of a conversion, so that changing any
+// of them converts every post again
+func configHash(cfg *Config) string {
+	timezone := ""
+	if cfg.Timezone != nil {
+		timezone = cfg.Timezone.String()
+	}
+	data, _ := json.Marshal(struct {
+		SourceFormat, TargetFormat Format
+		FileExtension              string
+		Direction                  Direction
+		JSONIndent                 int
+		JSONFenced                 bool
+		KeyOrder                   []string
+		KeyMappings                []MappingRule
+		ReplaceKeyMappings         bool
+		Timezone                   string
+		ConvertTags, Draft         bool
+		OldPermalink, NewPermalink string
+		Bundles                    bool
+	}{
+		cfg.SourceFormat, cfg.TargetFormat, cfg.FileExtension, cfg.ConversionDirection, cfg.JSONIndent,
+		cfg.JSONFenced, cfg.KeyOrder, cfg.KeyMappings, cfg.ReplaceKeyMappings, timezone,
+		cfg.ConvertTags, cfg.Draft, cfg.OldPermalink, cfg.NewPermalink, cfg.Bundles,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hex SHA-256 of a file, or an empty string if it does not exist
+func hashFile(file string) (string, error) {
+	sum, err := fileHash(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// startIncremental loads the manifest and drops the posts that need no conversion from jobs:
+// those whose source, options and output are unchanged since the last run, and those whose
+// output was edited by hand since then, unless cfg.Force is set.
+func startIncremental(srcDir, dstDir string, jobs []conversionJob, cfg *Config) (*incrementalRun, []conversionJob, error) {
+	run := &incrementalRun{
+		file:       cfg.ManifestFile,
+		configHash: configHash(cfg),
+		srcDir:     srcDir,
+		dstDir:     dstDir,
+		sourceHash: make(map[string]string),
+		urls:       make(map[string]postURLs),
+		logger:     loggerFor(cfg),
+	}
+	if run.file == "" {
+		run.file = filepath.Join(dstDir, DefaultManifestFile)
+	}
+	m, err := loadManifest(run.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	run.manifest = m
+
+	// Posts converted with other options are converted again, but their outputs stay protected
+	if m.Config != run.configHash {
+		for key, entry := range m.Files {
+			entry.Source, entry.OldURL, entry.NewURL = "", "", ""
+			m.Files[key] = entry
+		}
+	}
+
+	var remaining []conversionJob
+	for _, job := range jobs {
+		if job.processor == nil {
+			remaining = append(remaining, job) // Assets have their own unchanged checks
+			continue
+		}
+
+		key, dst, err := run.paths(job)
+		if err != nil {
+			return nil, nil, err
+		}
+		sourceHash, err := hashFile(job.src)
+		if err != nil {
+			return nil, nil, err
+		}
+		outputHash, err := hashFile(job.dst)
+		if err != nil {
+			return nil, nil, err
+		}
+		run.sourceHash[job.src] = sourceHash
+
+		entry, ok := m.Files[key]
+		inPlace := filepath.Clean(job.src) == filepath.Clean(job.dst)
+		switch {
+		case !ok || entry.Dst != dst || outputHash == "":
+		case entry.Source != "" && outputHash == entry.Output && (entry.Source == sourceHash || inPlace):
+			run.skip(job, entry, nil)
+			run.logger.Debug("skipped unchanged post", "file", job.src)
+			continue
+		case outputHash != entry.Output && !inPlace && !cfg.Force:
+			run.skip(job, entry, []Warning{{Message: fmt.Sprintf("%s was edited since the last run; not overwriting it", job.dst)}})
+			run.logger.Warn("output was edited since the last run; not overwriting it", "file", job.src, "path", job.dst)
+			continue
+		}
+		remaining = append(remaining, job)
+	}
+	return run, remaining, nil
+}
+
+// skip reports a post left out of the conversion, and keeps the URLs it had in the last run so
+// that they are still checked for collisions and written to the redirect map
+func (run *incrementalRun) skip(job conversionJob, entry manifestEntry, warnings []Warning) {
+	file := FileReport{Source: job.src, Destination: job.dst, Status: StatusSkipped}
+	file.Warnings = warnings
+	if entry.OldURL != "" {
+		file.OldURL, file.NewURL = entry.OldURL, entry.NewURL
+		run.urls[job.src] = postURLs{old: entry.OldURL, new: entry.NewURL}
+	}
+	run.skipped = append(run.skipped, file)
+}
+
+// paths returns the manifest key of a post job and its destination relative to the destination directory
+func (run *incrementalRun) paths(job conversionJob) (string, string, error) {
+	key, err := filepath.Rel(run.srcDir, job.src)
+	if err != nil {
+		return "", "", err
+	}
+	dst, err := filepath.Rel(run.dstDir, job.dst)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.ToSlash(key), filepath.ToSlash(dst), nil
+}
+
+// record stores the conversion of a post in the manifest, with the URLs it was converted with
+func (run *incrementalRun) record(job conversionJob, result FileResult) error {
+	if job.processor == nil {
+		return nil
+	}
+	key, dst, err := run.paths(job)
+	if err != nil {
+		return err
+	}
+	outputHash, err := hashFile(job.dst)
+	if err != nil {
+		return err
+	}
+
+	run.manifest.mu.Lock()
+	defer run.manifest.mu.Unlock()
+	run.manifest.Files[key] = manifestEntry{
+		Source: run.sourceHash[job.src],
+		Output: outputHash,
+		Dst:    dst,
+		OldURL: result.OldURL,
+		NewURL: result.NewURL,
+	}
+	return nil
+}
+
+// finish handles the posts whose source was deleted since the last run, then writes the
+// manifest. With prune, their outputs are removed unless they were edited by hand; otherwise
+// they are only reported. It returns the reports of those posts. If ctx was cancelled, deleted
+// sources are left for the next run, but the posts converted before the cancellation are still
+// recorded, so that their outputs are not taken for ones edited by hand.
+func (run *incrementalRun) finish(ctx context.Context, prune bool) ([]FileReport, error) {
+	m := run.manifest
+	if ctx.Err() != nil {
+		return nil, run.write(context.WithoutCancel(ctx))
+	}
+
+	keys := make([]string, 0, len(m.Files))
+	for key := range m.Files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var deleted []FileReport
+	for _, key := range keys {
+		src := filepath.Join(run.srcDir, filepath.FromSlash(key))
+		if _, err := os.Stat(src); !os.IsNotExist(err) {
+			continue
+		}
+		entry := m.Files[key]
+		dst := filepath.Join(run.dstDir, filepath.FromSlash(entry.Dst))
+		outputHash, err := hashFile(dst)
+		if err != nil {
+			return deleted, err
+		}
+
+		file := FileReport{Source: src, Destination: dst, Status: StatusSkipped}
+		switch {
+		case outputHash == "":
+			delete(m.Files, key)
+			continue
+		case !prune:
+			file.Warnings = []Warning{{Message: fmt.Sprintf("source was deleted; %s is left in place", dst)}}
+		case outputHash != entry.Output:
+			file.Warnings = []Warning{{Message: fmt.Sprintf("source was deleted, but %s was edited since the last run; not removing it", dst)}}
+		default:
+			if err := os.Remove(dst); err != nil {
+				return deleted, fmt.Errorf("removing output of deleted source: %w", err)
+			}
+			file.Status = StatusRemoved
+			run.logger.Info("removed output of deleted source", "file", src, "path", dst)
+			delete(m.Files, key)
+		}
+		for _, warning := range file.Warnings {
+			run.logger.Warn(warning.Message, "file", src)
+		}
+		deleted = append(deleted, file)
+	}
+
+	return deleted, run.write(ctx)
+}
+
+// write writes the manifest, recording the options of this run
+func (run *incrementalRun) write(ctx context.Context) error {
+	m := run.manifest
+	m.Config = run.configHash
+	return writeAtomic(ctx, run.file, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	})
+}
@@ -0,0 +1,361 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidMappingRule is returned for key mapping rules that cannot be applied
+var ErrInvalidMappingRule = errors.New("invalid mapping rule")
+
+// StringList is a list of strings, such as front matter keys, that may also be written as a single string
+type StringList []string
+
+// UnmarshalYAML accepts a single string or a list of strings
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+	var items []string
+	if err := node.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+// UnmarshalTOML accepts a single string or a list of strings
+func (l *StringList) UnmarshalTOML(v interface{}) error {
+	switch value := v.(type) {
+	case string:
+		*l = StringList{value}
+	case []interface{}:
+		items := make(StringList, 0, len(value))
+		for _, item := range value {
+			str, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("list item must be a string, got %T", item)
+			}
+			items = append(items, str)
+		}
+		*l = items
+	default:
+		return fmt.Errorf("must be a string or a list of strings, got %T", v)
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts a single string or a list of strings
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*l = StringList{str}
+		return nil
+	}
+	var items []string
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+// MappingRule describes how one front matter value is rewritten. From and To are key paths such
+// as cover.image, params.toc or images[0]. The value of From is moved to every path in To, so
+// listing several paths copies it; Delete drops the value instead. Transform lists value
+// transforms, such as negate or split:;, applied in order before the value is stored.
+type MappingRule struct {
+	From      string     `yaml:"from" toml:"from" json:"from"`
+	To        StringList `yaml:"to,omitempty" toml:"to,omitempty" json:"to,omitempty"`
+	Delete    bool       `yaml:"delete,omitempty" toml:"delete,omitempty" json:"delete,omitempty"`
+	Transform StringList `yaml:"transform,omitempty" toml:"transform,omitempty" json:"transform,omitempty"`
+}
+
+// MappingFile is the content of a user-defined key mapping file
+type MappingFile struct {
+	Replace bool          `yaml:"replace" toml:"replace" json:"replace"` // Replace the built-in mappings instead of merging
+	Rules   []MappingRule `yaml:"rules" toml:"rules" json:"rules"`
+}
+
+// mappingFileFormats maps mapping file extensions to the format they are read as
+var mappingFileFormats = map[string]Format{
+	".yaml": FormatYAML,
+	".yml":  FormatYAML,
+	".toml": FormatTOML,
+	".json": FormatJSON,
+}
+
+// LoadMappingFile reads key mapping rules from a YAML, TOML or JSON file
+func LoadMappingFile(path string) (*MappingFile, error) {
+	format, ok := mappingFileFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("%w: mapping file %s", ErrUnsupportedFormat, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading mapping file: %w", err)
+	}
+
+	var file MappingFile
+	if err := formatHandlers[format].Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing mapping file %s: %w", path, err)
+	}
+
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("mapping file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// validate checks that every rule of a mapping file compiles
+func (f *MappingFile) validate() error {
+	for _, rule := range f.Rules {
+		if _, err := rule.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks that a rule names its source key and exactly one action
+func (r MappingRule) validate() error {
+	switch {
+	case r.From == "":
+		return fmt.Errorf("%w: missing from key", ErrInvalidMappingRule)
+	case r.Delete && (len(r.To) > 0 || len(r.Transform) > 0):
+		return fmt.Errorf("%w: %s: delete cannot be combined with to or transform", ErrInvalidMappingRule, r.From)
+	case !r.Delete && len(r.To) == 0:
+		return fmt.Errorf("%w: %s: needs to or delete", ErrInvalidMappingRule, r.From)
+	}
+	for _, key := range r.To {
+		if key == "" {
+			return fmt.Errorf("%w: %s: empty target key", ErrInvalidMappingRule, r.From)
+		}
+	}
+	return nil
+}
+
+// compiledRule is a MappingRule with its key paths and transforms parsed
+type compiledRule struct {
+	MappingRule
+	from       keyPath
+	to         []keyPath
+	transforms []parsedTransform
+}
+
+// compile parses the key paths and transforms of a rule
+func (r MappingRule) compile() (compiledRule, error) {
+	if err := r.validate(); err != nil {
+		return compiledRule{}, err
+	}
+
+	from, err := parseKeyPath(r.From)
+	if err != nil {
+		return compiledRule{}, fmt.Errorf("%w: %v", ErrInvalidMappingRule, err)
+	}
+	compiled := compiledRule{MappingRule: r, from: from}
+	for _, target := range r.To {
+		to, err := parseKeyPath(target)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("%w: %v", ErrInvalidMappingRule, err)
+		}
+		compiled.to = append(compiled.to, to)
+	}
+	for _, spec := range r.Transform {
+		transform, err := parseTransform(spec)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("%w: %s: %v", ErrInvalidMappingRule, r.From, err)
+		}
+		compiled.transforms = append(compiled.transforms, transform)
+	}
+	return compiled, nil
+}
+
+// mappingRules returns the rules for a conversion: the built-in mappings for the direction,
+// overridden and extended by the configured rules, or only the configured rules if they replace them.
+// Rules are ordered by source path so that conflicting rules resolve the same way on every run.
+func mappingRules(cfg *Config) ([]compiledRule, error) {
+	byFrom := make(map[string]MappingRule)
+	if !cfg.ReplaceKeyMappings {
+		for _, rule := range keyMappings[cfg.ConversionDirection] {
+			byFrom[rule.From] = rule
+		}
+	}
+	for _, rule := range cfg.KeyMappings {
+		byFrom[rule.From] = rule
+	}
+
+	rules := make([]compiledRule, 0, len(byFrom))
+	for _, rule := range byFrom {
+		compiled, err := rule.compile()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, compiled)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].From < rules[j].From })
+	return rules, nil
+}
+
+// pendingWrite is a value a mapping rule stores once all sources have been removed
+type pendingWrite struct {
+	path  keyPath
+	key   *yaml.Node // Key node to reuse for the new pair, if any
+	value *yaml.Node
+	after *yaml.Node // Insert the pair right after this key of the same mapping, if set
+}
+
+// applyMappingRules rewrites the keys of a front matter tree in place. Every source is resolved
+// before the tree changes, so rules see the original keys and swapping two keys works. A value
+// is transformed first; then, if its first target lives in the same mapping, it is renamed where
+// it stands and keeps its comments. Otherwise it moves to the target path, creating intermediate
+// mappings and removing ones left empty. Further targets receive copies. Keys produced by a rule
+// win over existing keys. A value a transform leaves as it was is still moved, with a warning.
+func applyMappingRules(root *yaml.Node, rules []compiledRule) ([]string, error) {
+	type match struct {
+		rule compiledRule
+		loc  *pathLocation
+	}
+	var matches []match
+	for _, rule := range rules {
+		if loc, ok := lookupPath(root, rule.from); ok {
+			matches = append(matches, match{rule: rule, loc: loc})
+		}
+	}
+
+	var warnings []string
+	for _, m := range matches {
+		warning, err := transformNode(m.loc.value, m.rule.transforms)
+		if err != nil {
+			return nil, fmt.Errorf("transforming %s: %w", m.rule.From, err)
+		}
+		if warning != "" {
+			warnings = append(warnings, fmt.Sprintf("transforming %s: %s", m.rule.From, warning))
+		}
+	}
+
+	var (
+		removals []*pathLocation
+		writes   []pendingWrite
+		renamed  = make(map[*yaml.Node]bool)
+		touched  []*yaml.Node
+	)
+	for _, m := range matches {
+		if m.rule.Delete {
+			removals = append(removals, m.loc)
+			continue
+		}
+
+		parent := m.loc.containers[len(m.loc.containers)-1]
+		var anchor *yaml.Node
+		for i, target := range m.rule.to {
+			sameParent := m.loc.key != nil && target[len(target)-1].index < 0 && parentOf(root, target) == parent
+			switch {
+			case i == 0 && sameParent:
+				m.loc.key.Value = target[len(target)-1].key
+				renamed[m.loc.key] = true
+				touched = append(touched, parent)
+				anchor = m.loc.key
+			case i == 0:
+				removals = append(removals, m.loc)
+				writes = append(writes, pendingWrite{path: target, key: m.loc.key, value: m.loc.value})
+			case sameParent && anchor != nil:
+				key := scalarNode(tagString, target[len(target)-1].key)
+				writes = append(writes, pendingWrite{path: target, key: key, value: cloneNode(m.loc.value), after: anchor})
+				anchor = key
+			default:
+				writes = append(writes, pendingWrite{path: target, value: cloneNode(m.loc.value)})
+			}
+		}
+	}
+
+	for _, parent := range touched {
+		dropShadowedKeys(parent, renamed)
+	}
+	for _, loc := range removals {
+		removeLocation(loc)
+	}
+	for _, w := range writes {
+		if w.after == nil || !insertAfter(parentOf(root, w.path), w.after, w.key, w.value) {
+			if err := setPath(root, w.path, w.key, w.value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// parentOf returns the container that path's last segment lives in, or nil if it does not exist
+func parentOf(root *yaml.Node, path keyPath) *yaml.Node {
+	loc, ok := lookupPath(root, path[:len(path)-1])
+	if !ok {
+		return nil
+	}
+	return resolveAlias(loc.value)
+}
+
+// dropShadowedKeys removes keys of mapping that share a name with a renamed key,
+// keeping the first renamed key of each name
+func dropShadowedKeys(mapping *yaml.Node, renamed map[*yaml.Node]bool) {
+	names := make(map[string]bool)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if renamed[mapping.Content[i]] {
+			names[mapping.Content[i].Value] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	content := mapping.Content[:0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key := mapping.Content[i]
+		if names[key.Value] && (!renamed[key] || seen[key.Value]) {
+			continue
+		}
+		seen[key.Value] = true
+		content = append(content, key, mapping.Content[i+1])
+	}
+	mapping.Content = content
+}
+
+// insertAfter stores key and value in mapping right after the anchor key, replacing any existing
+// pair with the same key. It reports false if the anchor is not a key of mapping.
+func insertAfter(mapping, anchor, key, value *yaml.Node) bool {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key.Value && mapping.Content[i] != anchor {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			break
+		}
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i] == anchor {
+			rest := append([]*yaml.Node{key, value}, mapping.Content[i+2:]...)
+			mapping.Content = append(mapping.Content[:i+2], rest...)
+			return true
+		}
+	}
+	return false
+}
+
+// cloneNode returns a deep copy of node
+func cloneNode(node *yaml.Node) *yaml.Node {
+	clone := *node
+	if node.Content != nil {
+		clone.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			clone.Content[i] = cloneNode(child)
+		}
+	}
+	return &clone
+}
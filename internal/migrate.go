@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PathRule maps a path of a Hexo project to a path of the Hugo site it is migrated to.
+// Paths are relative to the project and site roots and use forward slashes.
+type PathRule struct {
+	From    string `yaml:"from" toml:"from" json:"from"`
+	To      string `yaml:"to" toml:"to" json:"to"`
+	Assets  string `yaml:"assets,omitempty" toml:"assets,omitempty" json:"assets,omitempty"`    // Destination of files other than posts, if not To
+	Draft   bool   `yaml:"draft,omitempty" toml:"draft,omitempty" json:"draft,omitempty"`       // Mark the posts as drafts
+	Flatten bool   `yaml:"flatten,omitempty" toml:"flatten,omitempty" json:"flatten,omitempty"` // Write about/index.md as about.md
+}
+
+// LayoutFile is the content of a user-defined site layout file
+type LayoutFile struct {
+	Replace bool       `yaml:"replace" toml:"replace" json:"replace"` // Replace the default layout instead of merging
+	Rules   []PathRule `yaml:"rules" toml:"rules" json:"rules"`
+}
+
+// DefaultHexoLayout maps the standard Hexo project layout to a Hugo site. Files and directories
+// under source whose names start with _ or . are skipped, as Hexo does.
+var DefaultHexoLayout = []PathRule{
+	{From: "source/_posts", To: "content/posts"},
+	{From: "source/_drafts", To: "content/posts", Draft: true},
+	{From: "source/images", To: "static/images"},
+	{From: "source", To: "content", Assets: "static", Flatten: true},
+}
+
+// LoadLayoutFile reads site layout rules from a YAML, TOML or JSON file
+func LoadLayoutFile(path string) (*LayoutFile, error) {
+	format, ok := mappingFileFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("%w: layout file %s", ErrUnsupportedFormat, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading layout file: %w", err)
+	}
+
+	var file LayoutFile
+	if err := formatHandlers[format].Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing layout file %s: %w", path, err)
+	}
+
+	if err := file.validate(); err != nil {
+		return nil, fmt.Errorf("layout file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// validate checks that every rule of a layout file has both paths
+func (f *LayoutFile) validate() error {
+	for _, rule := range f.Rules {
+		if rule.From == "" || rule.To == "" {
+			return errors.New("rule needs from and to paths")
+		}
+	}
+	return nil
+}
+
+// LayoutRules returns the default layout overridden and extended by rules, or only rules if they replace it
+func LayoutRules(rules []PathRule, replace bool) []PathRule {
+	byFrom := make(map[string]PathRule)
+	if !replace {
+		for _, rule := range DefaultHexoLayout {
+			byFrom[rule.From] = rule
+		}
+	}
+	for _, rule := range rules {
+		byFrom[path.Clean(rule.From)] = rule
+	}
+
+	merged := make([]PathRule, 0, len(byFrom))
+	for from, rule := range byFrom {
+		rule.From = from
+		merged = append(merged, rule)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].From < merged[j].From })
+	return merged
+}
+
+// MigrateSite migrates the Hexo project at projectDir to a Hugo site at siteDir. Every file under
+// a rule's From path is placed under its To path by the most specific rule: posts are converted,
+// other files are placed by cfg.AssetMode, copied if it is none. The report lists what was done
+// with each file. Cancelling ctx stops the migration.
+func MigrateSite(ctx context.Context, projectDir, siteDir string, layout []PathRule, cfg *Config) (*Report, error) {
+	if cfg == nil {
+		cfg = NewDefaultConfig()
+	}
+	if err := validateAssetOptions(cfg); err != nil {
+		return nil, err
+	}
+
+	// Files other than posts are part of the site, so they are copied unless another mode is set
+	assetMode := cfg.AssetMode
+	if assetMode == "" || assetMode == AssetNone {
+		assetMode = AssetCopy
+	}
+
+	converter, err := NewMarkdownConverter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating markdown converter: %w", err)
+	}
+	draftCfg := *cfg
+	draftCfg.Draft = true
+	draftConverter, err := NewMarkdownConverter(&draftCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating markdown converter: %w", err)
+	}
+
+	var jobs []conversionJob
+	sources := make(map[string]string)
+	for _, rule := range layout {
+		root := filepath.Join(projectDir, filepath.FromSlash(rule.From))
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+
+		// Posts are named relative to the rule's path, so :title in old URLs matches Hexo's
+		processor := NewFileProcessor(converter, root, siteDir, cfg.FileExtension)
+		if rule.Draft {
+			processor = NewFileProcessor(draftConverter, root, siteDir, cfg.FileExtension)
+		}
+
+		err := filepath.WalkDir(root, func(srcPath string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			relPath, err := filepath.Rel(projectDir, srcPath)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if owner, ok := matchPathRule(layout, relPath); !ok || owner.From != rule.From {
+				return nil // Skipped, or placed by a more specific rule
+			}
+
+			within := strings.TrimPrefix(strings.TrimPrefix(relPath, rule.From), "/")
+			if within == "" {
+				within = path.Base(relPath)
+			} else if isHiddenPath(within) {
+				return nil
+			}
+
+			job := conversionJob{src: srcPath, dst: migratedPath(rule, within, cfg.FileExtension)}
+			if strings.HasSuffix(within, cfg.FileExtension) {
+				job.processor = processor
+			} else if includeAsset(relPath, cfg) {
+				job.mode = assetMode
+			} else {
+				return nil
+			}
+			job.dst = filepath.Join(siteDir, filepath.FromSlash(job.dst))
+			if job.processor != nil {
+				job.dst = job.processor.targetPath(srcPath, job.dst)
+			}
+
+			if other, ok := sources[job.dst]; ok {
+				return fmt.Errorf("%s and %s both migrate to %s", other, srcPath, job.dst)
+			}
+			sources[job.dst] = srcPath
+			jobs = append(jobs, job)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walking %s: %w", root, err)
+		}
+	}
+
+	start := time.Now()
+	report := &Report{SrcDir: projectDir, DstDir: siteDir, DryRun: cfg.DryRun}
+	err = runJobs(ctx, jobs, cfg, report, nil, nil)
+	report.Duration = time.Since(start)
+	return report, err
+}
+
+// matchPathRule returns the rule with the longest From path that contains relPath
+func matchPathRule(layout []PathRule, relPath string) (PathRule, bool) {
+	var (
+		best  PathRule
+		found bool
+	)
+	for _, rule := range layout {
+		if relPath != rule.From && !strings.HasPrefix(relPath, rule.From+"/") {
+			continue
+		}
+		if !found || len(rule.From) > len(best.From) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// migratedPath returns the slash-separated site path of a file at within, relative to the rule's From path
+func migratedPath(rule PathRule, within, ext string) string {
+	if !strings.HasSuffix(within, ext) {
+		dir := rule.To
+		if rule.Assets != "" {
+			dir = rule.Assets
+		}
+		return path.Join(dir, within)
+	}
+
+	if rule.Flatten && path.Base(within) == "index"+ext && path.Dir(within) != "." {
+		within = path.Dir(within) + ext
+	}
+	return path.Join(rule.To, within)
+}
+
+// isHiddenPath reports whether a path has a segment starting with _ or ., which Hexo does not render
+func isHiddenPath(relPath string) bool {
+	for _, segment := range strings.Split(relPath, "/") {
+		if strings.HasPrefix(segment, "_") || strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,534 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Front matter is carried through conversion as a yaml.Node tree so that key order and,
+// for YAML sources, comments survive. The helpers below build that tree from TOML and JSON
+// and serialize it back to either format.
+
+// YAML node tags used when building nodes from TOML and JSON
+const (
+	tagString    = "!!str"
+	tagInt       = "!!int"
+	tagFloat     = "!!float"
+	tagBool      = "!!bool"
+	tagNull      = "!!null"
+	tagTimestamp = "!!timestamp"
+)
+
+// ErrNotMapping is returned when a front matter block does not hold a mapping
+var ErrNotMapping = errors.New("front matter is not a mapping")
+
+// bareTOMLKey matches keys that need no quoting in TOML
+var bareTOMLKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// nodePair is a key/value pair of a mapping node
+type nodePair struct {
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+// frontMatterMapping returns the root mapping of a decoded front matter document,
+// turning an empty document into an empty mapping
+func frontMatterMapping(doc *yaml.Node) (*yaml.Node, error) {
+	if doc.Kind == 0 {
+		*doc = yaml.Node{Kind: yaml.DocumentNode}
+	}
+	if doc.Kind != yaml.DocumentNode {
+		*doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{doc}}
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+	}
+
+	mapping := resolveAlias(doc.Content[0])
+	if mapping.Kind != yaml.MappingNode {
+		return nil, ErrNotMapping
+	}
+	return mapping, nil
+}
+
+// resolveAlias follows YAML aliases to the anchored node
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// mappingPairs returns the pairs of mapping with the keys in priority first, in that order,
+// followed by the remaining keys in their original order
+func mappingPairs(mapping *yaml.Node, priority []string) []nodePair {
+	pairs := make([]nodePair, 0, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		pairs = append(pairs, nodePair{key: mapping.Content[i], value: mapping.Content[i+1]})
+	}
+	if len(priority) == 0 {
+		return pairs
+	}
+
+	rank := make(map[string]int, len(priority))
+	for i, key := range priority {
+		if _, ok := rank[key]; !ok {
+			rank[key] = i
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		ri, iok := rank[pairs[i].key.Value]
+		rj, jok := rank[pairs[j].key.Value]
+		switch {
+		case iok && jok:
+			return ri < rj
+		default:
+			return iok && !jok
+		}
+	})
+	return pairs
+}
+
+// scalarNode creates a scalar node with the given tag and value
+func scalarNode(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// decodeTOMLNode parses a TOML document into a yaml.Node tree in document order
+func decodeTOMLNode(data []byte, node *yaml.Node) error {
+	var values map[string]interface{}
+	md, err := toml.Decode(string(data), &values)
+	if err != nil {
+		return err
+	}
+
+	// Record the order in which each table's keys appear
+	order := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, key := range md.Keys() {
+		if full := key.String(); !seen[full] {
+			seen[full] = true
+			parent := key[:len(key)-1].String()
+			order[parent] = append(order[parent], key[len(key)-1])
+		}
+	}
+
+	mapping, err := tomlValueNode(values, nil, order)
+	if err != nil {
+		return err
+	}
+	*node = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{mapping}}
+	return nil
+}
+
+// tomlValueNode converts a decoded TOML value at path into a yaml.Node
+func tomlValueNode(v interface{}, path toml.Key, order map[string][]string) (*yaml.Node, error) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range orderedTableKeys(value, order[path.String()]) {
+			child, err := tomlValueNode(value[key], append(path[:len(path):len(path)], key), order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, scalarNode(tagString, key), child)
+		}
+		return node, nil
+	case []map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range value {
+			child, err := tomlValueNode(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range value {
+			child, err := tomlValueNode(item, path, order)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case time.Time:
+		switch value.Location().String() {
+		case "date-local":
+			return scalarNode(tagTimestamp, value.Format("2006-01-02")), nil
+		case "datetime-local":
+			return scalarNode(tagTimestamp, value.Format("2006-01-02 15:04:05.999999999")), nil
+		case "time-local":
+			return scalarNode(tagString, value.Format("15:04:05.999999999")), nil
+		}
+		return scalarNode(tagTimestamp, value.Format(time.RFC3339Nano)), nil
+	default:
+		node := &yaml.Node{}
+		if err := node.Encode(value); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
+
+// orderedTableKeys returns the keys of table in document order, with any unrecorded keys sorted last
+func orderedTableKeys(table map[string]interface{}, order []string) []string {
+	keys := make([]string, 0, len(table))
+	seen := make(map[string]bool, len(table))
+	for _, key := range order {
+		if _, ok := table[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	var rest []string
+	for key := range table {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// encodeTOMLNode writes a front matter document as TOML. Top-level keys in keyOrder come first,
+// and plain values precede tables as TOML requires. YAML comments are carried over.
+func encodeTOMLNode(w io.Writer, doc *yaml.Node, keyOrder []string) error {
+	mapping, err := frontMatterMapping(doc)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writeTOMLComment(&buf, doc.HeadComment)
+	if err := writeTOMLTable(&buf, nil, mappingPairs(mapping, keyOrder)); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// writeTOMLTable writes the pairs of the table at path, followed by its sub-tables
+func writeTOMLTable(buf *bytes.Buffer, path []string, pairs []nodePair) error {
+	var tables []nodePair
+	for _, pair := range pairs {
+		value := resolveAlias(pair.value)
+		if value.Tag == tagNull {
+			continue // TOML has no null
+		}
+		if isTOMLTable(value) || isTOMLTableArray(value) {
+			tables = append(tables, pair)
+			continue
+		}
+
+		inline, err := tomlInlineValue(value)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", pair.key.Value, err)
+		}
+		writeTOMLComment(buf, pair.key.HeadComment)
+		buf.WriteString(tomlKey(pair.key.Value) + " = " + inline)
+		writeTOMLLineComment(buf, pair.key.LineComment, value.LineComment)
+	}
+
+	for _, pair := range tables {
+		value := resolveAlias(pair.value)
+		tablePath := append(path[:len(path):len(path)], tomlKey(pair.key.Value))
+		header := strings.Join(tablePath, ".")
+
+		buf.WriteString("\n")
+		writeTOMLComment(buf, pair.key.HeadComment)
+		if value.Kind == yaml.MappingNode {
+			buf.WriteString("[" + header + "]\n")
+			if err := writeTOMLTable(buf, tablePath, mappingPairs(value, nil)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for i, item := range value.Content {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			buf.WriteString("[[" + header + "]]\n")
+			if err := writeTOMLTable(buf, tablePath, mappingPairs(resolveAlias(item), nil)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTOMLTable reports whether node is written as a TOML table
+func isTOMLTable(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode && len(node.Content) > 0
+}
+
+// isTOMLTableArray reports whether node is written as a TOML array of tables
+func isTOMLTableArray(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		if resolveAlias(item).Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlInlineValue renders node as an inline TOML value
+func tomlInlineValue(node *yaml.Node) (string, error) {
+	node = resolveAlias(node)
+	switch node.Kind {
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			inline, err := tomlInlineValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, inline)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case yaml.MappingNode:
+		items := make([]string, 0, len(node.Content)/2)
+		for _, pair := range mappingPairs(node, nil) {
+			inline, err := tomlInlineValue(pair.value)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, tomlKey(pair.key.Value)+" = "+inline)
+		}
+		if len(items) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	}
+
+	if node.Tag == tagNull {
+		return "", errors.New("TOML cannot represent null values")
+	}
+	if node.Tag == tagTimestamp && isTOMLDatetime(node.Value) {
+		return node.Value, nil
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return "", err
+	}
+	if n, ok := value.(uint64); ok && n > math.MaxInt64 {
+		return "", fmt.Errorf("TOML cannot represent integer %s, which is out of the 64-bit signed range", node.Value)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]interface{}{"v": value}); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(buf.String(), "v = "), "\n"), nil
+}
+
+// isTOMLDatetime reports whether s is a valid TOML date, time or datetime literal
+func isTOMLDatetime(s string) bool {
+	var probe map[string]interface{}
+	if _, err := toml.Decode("v = "+s, &probe); err != nil {
+		return false
+	}
+	_, ok := probe["v"].(time.Time)
+	return ok
+}
+
+// tomlKey quotes key if it cannot be written bare
+func tomlKey(key string) string {
+	if bareTOMLKey.MatchString(key) {
+		return key
+	}
+	quoted, _ := json.Marshal(key)
+	return string(quoted)
+}
+
+// writeTOMLComment writes a YAML head comment as TOML comment lines
+func writeTOMLComment(buf *bytes.Buffer, comment string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		buf.WriteString(tomlCommentLine(line) + "\n")
+	}
+}
+
+// writeTOMLLineComment ends a key/value line with the first non-empty YAML line comment
+func writeTOMLLineComment(buf *bytes.Buffer, comments ...string) {
+	for _, comment := range comments {
+		if comment != "" {
+			buf.WriteString(" " + tomlCommentLine(comment))
+			break
+		}
+	}
+	buf.WriteString("\n")
+}
+
+// tomlCommentLine makes sure a comment line starts with a hash
+func tomlCommentLine(line string) string {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return line
+	}
+	return "# " + line
+}
+
+// decodeJSONNode parses a JSON document into a yaml.Node tree in document order
+func decodeJSONNode(data []byte, node *yaml.Node) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	value, err := jsonValueNode(decoder)
+	if err != nil {
+		return err
+	}
+	*node = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{value}}
+	return nil
+}
+
+// jsonValueNode reads the next JSON value from decoder into a yaml.Node
+func jsonValueNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if value == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, scalarNode(tagString, key.(string)))
+			}
+			child, err := jsonValueNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		if _, err := decoder.Token(); err != nil { // closing delimiter
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return scalarNode(tagString, value), nil
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return scalarNode(tagInt, value.String()), nil
+		}
+		return scalarNode(tagFloat, value.String()), nil
+	case bool:
+		return scalarNode(tagBool, strconv.FormatBool(value)), nil
+	default:
+		return scalarNode(tagNull, "null"), nil
+	}
+}
+
+// encodeJSONNode writes a front matter document as JSON. Top-level keys in the handler's
+// KeyOrder come first; the rest keep their original order.
+func encodeJSONNode(w io.Writer, doc *yaml.Node, h JSONHandler) error {
+	mapping, err := frontMatterMapping(doc)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := h.writeNode(&buf, mapping, 0, h.KeyOrder); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// writeNode writes node as JSON at the given nesting depth
+func (h JSONHandler) writeNode(buf *bytes.Buffer, node *yaml.Node, depth int, keyOrder []string) error {
+	node = resolveAlias(node)
+	newline, separator := "", ":"
+	if h.Indent != "" {
+		newline, separator = "\n", ": "
+	}
+	indent := strings.Repeat(h.Indent, depth+1)
+
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close := "[", "]"
+		if node.Kind == yaml.MappingNode {
+			open, close = "{", "}"
+		}
+		if len(node.Content) == 0 {
+			buf.WriteString(open + close)
+			return nil
+		}
+
+		buf.WriteString(open + newline)
+		if node.Kind == yaml.MappingNode {
+			pairs := mappingPairs(node, keyOrder)
+			for i, pair := range pairs {
+				buf.WriteString(indent)
+				if err := h.encode(buf, pair.key.Value, ""); err != nil {
+					return err
+				}
+				buf.WriteString(separator)
+				if err := h.writeNode(buf, pair.value, depth+1, nil); err != nil {
+					return err
+				}
+				if i < len(pairs)-1 {
+					buf.WriteString(",")
+				}
+				buf.WriteString(newline)
+			}
+		} else {
+			for i, item := range node.Content {
+				buf.WriteString(indent)
+				if err := h.writeNode(buf, item, depth+1, nil); err != nil {
+					return err
+				}
+				if i < len(node.Content)-1 {
+					buf.WriteString(",")
+				}
+				buf.WriteString(newline)
+			}
+		}
+		buf.WriteString(strings.Repeat(h.Indent, depth) + close)
+		return nil
+	}
+
+	switch node.Tag {
+	case tagNull:
+		buf.WriteString("null")
+		return nil
+	case tagTimestamp:
+		return h.encode(buf, node.Value, "")
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	return h.encode(buf, value, "")
+}
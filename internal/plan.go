@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyRename is a front matter key moved to other keys by a mapping rule
+type KeyRename struct {
+	From string   `json:"from"`
+	To   []string `json:"to"`
+}
+
+// leafKeyPaths returns the dotted paths of the values under a front matter mapping that are not
+// themselves mappings with keys. Sequences count as single values.
+func leafKeyPaths(mapping *yaml.Node) map[string]bool {
+	paths := make(map[string]bool)
+	var walk func(node *yaml.Node, prefix string)
+	walk = func(node *yaml.Node, prefix string) {
+		for _, pair := range mappingPairs(node, nil) {
+			key := prefix + pair.key.Value
+			if value := resolveAlias(pair.value); value.Kind == yaml.MappingNode && len(value.Content) > 0 {
+				walk(value, key+".")
+				continue
+			}
+			paths[key] = true
+		}
+	}
+	walk(mapping, "")
+	return paths
+}
+
+// matchedRenames returns the rules that move a key present in mapping, before they are applied
+func matchedRenames(mapping *yaml.Node, rules []compiledRule) []KeyRename {
+	var renames []KeyRename
+	for _, rule := range rules {
+		if _, ok := lookupPath(mapping, rule.from); ok && !rule.Delete {
+			renames = append(renames, KeyRename{From: rule.From, To: rule.To})
+		}
+	}
+	return renames
+}
+
+// recordKeyChanges fills in the keys a conversion renamed, added and removed, given the leaf
+// paths of the front matter before it and the renames that were applied
+func recordKeyChanges(result *FileResult, before map[string]bool, mapping *yaml.Node, renames []KeyRename) {
+	after := leafKeyPaths(mapping)
+	moved := make(map[string]bool)
+	for _, rename := range renames {
+		moved[rename.From] = true
+		for _, to := range rename.To {
+			moved[to] = true
+		}
+	}
+
+	result.Renamed = renames
+	result.Added, result.Removed = nil, nil
+	for path := range after {
+		if !before[path] && !moved[path] && !movedPrefix(moved, path) {
+			result.Added = append(result.Added, path)
+		}
+	}
+	for path := range before {
+		if !after[path] && !moved[path] && !movedPrefix(moved, path) {
+			result.Removed = append(result.Removed, path)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+}
+
+// movedPrefix reports whether path lies below a key that was moved as a whole
+func movedPrefix(moved map[string]bool, path string) bool {
+	for key := range moved {
+		if strings.HasPrefix(path, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanFile converts the Markdown file at srcPath like ConvertFile without writing anything. With
+// diff, the result holds a unified diff between the source file and the output for dstPath.
+func (fp *FileProcessor) PlanFile(ctx context.Context, srcPath, dstPath string, diff bool) (FileResult, error) {
+	select {
+	case <-ctx.Done():
+		return FileResult{}, ctx.Err()
+	default:
+	}
+
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return FileResult{}, fmt.Errorf("reading source file: %w", err)
+	}
+	name, err := filepath.Rel(fp.srcDir, srcPath)
+	if err != nil {
+		return FileResult{}, fmt.Errorf("getting relative path: %w", err)
+	}
+
+	var out bytes.Buffer
+	result, err := fp.converter.convertMarkdown(bytes.NewReader(content), &out, filepath.ToSlash(name), fp.bundleFolder(srcPath))
+	logResult(fileLogger(ctx, fp.converter.logger, srcPath), result)
+	if err != nil {
+		return result, err
+	}
+	if diff {
+		result.Diff = unifiedDiff(srcPath, dstPath, string(content), out.String())
+	}
+	return result, nil
+}
+
+// printPlan reports what a dry run would do with each file: where it would be written, how
+// its front matter keys would change, and the diff if one was computed
+func printPlan(srcDir string, jobs []conversionJob, results map[string]FileResult) {
+	for _, job := range jobs {
+		relPath, err := filepath.Rel(srcDir, job.src)
+		if err != nil {
+			relPath = job.src
+		}
+		if job.processor == nil {
+			fmt.Printf("%s -> %s (%s)\n", relPath, job.dst, job.mode)
+			continue
+		}
+
+		result, ok := results[job.src]
+		if !ok {
+			continue // Failed, reported with the errors
+		}
+		fmt.Printf("%s -> %s\n", relPath, job.dst)
+		for _, rename := range result.Renamed {
+			fmt.Printf("  renamed: %s -> %s\n", rename.From, strings.Join(rename.To, ", "))
+		}
+		if len(result.Added) > 0 {
+			fmt.Printf("  added: %s\n", strings.Join(result.Added, ", "))
+		}
+		if len(result.Removed) > 0 {
+			fmt.Printf("  removed: %s\n", strings.Join(result.Removed, ", "))
+		}
+		if result.Diff != "" {
+			fmt.Print(result.Diff)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProjectFileNames are the names of project configuration files, in the order they are looked for
+var ProjectFileNames = []string{".h2h.yaml", ".h2h.yml", "h2h.yaml", "h2h.yml", ".h2h.toml", "h2h.toml", ".h2h.json", "h2h.json"}
+
+// ErrUnknownProfile is returned when a profile is selected that the project file does not define
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// Sections of a project file that are not options
+const (
+	projectMappingsKey = "mappings"
+	projectLayoutKey   = "layout-rules"
+	projectProfilesKey = "profiles"
+)
+
+// ProjectSettings are the settings of a project file or one of its profiles
+type ProjectSettings struct {
+	Options  map[string]string // Option values by flag name, as they would be given on the command line
+	Mappings *MappingFile      // Key mappings, as in a mapping file
+	Layout   *LayoutFile       // Path rules of a migration, as in a layout file
+}
+
+// ProjectFile is the content of a project configuration file: settings, and named profiles
+// whose settings are layered over them
+type ProjectFile struct {
+	Path string
+	ProjectSettings
+	Profiles map[string]ProjectSettings
+}
+
+// projectSections holds the sections of a project file that are decoded as structures
+type projectSections struct {
+	Mappings *MappingFile `yaml:"mappings" toml:"mappings" json:"mappings"`
+	Layout   *LayoutFile  `yaml:"layout-rules" toml:"layout-rules" json:"layout-rules"`
+	Profiles map[string]struct {
+		Mappings *MappingFile `yaml:"mappings" toml:"mappings" json:"mappings"`
+		Layout   *LayoutFile  `yaml:"layout-rules" toml:"layout-rules" json:"layout-rules"`
+	} `yaml:"profiles" toml:"profiles" json:"profiles"`
+}
+
+// FindProjectFile returns the first project file found in dirs, or an empty string if there is none
+func FindProjectFile(dirs ...string) string {
+	for _, dir := range dirs {
+		for _, name := range ProjectFileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// LoadProjectFile reads a YAML, TOML or JSON project configuration file
+func LoadProjectFile(path string) (*ProjectFile, error) {
+	format, ok := mappingFileFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("%w: project file %s", ErrUnsupportedFormat, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading project file: %w", err)
+	}
+
+	var values map[string]interface{}
+	if err := formatHandlers[format].Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parsing project file %s: %w", path, err)
+	}
+
+	file := &ProjectFile{Path: path, Profiles: make(map[string]ProjectSettings)}
+	if file.Options, err = projectOptions(values); err != nil {
+		return nil, fmt.Errorf("project file %s: %w", path, err)
+	}
+
+	profiles, _ := values[projectProfilesKey].(map[string]interface{})
+	if _, ok := values[projectProfilesKey]; ok && profiles == nil {
+		return nil, fmt.Errorf("project file %s: profiles must be a map of names to settings", path)
+	}
+	for name, value := range profiles {
+		profileValues, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("project file %s: profile %s must be a map of settings", path, name)
+		}
+		options, err := projectOptions(profileValues)
+		if err != nil {
+			return nil, fmt.Errorf("project file %s: profile %s: %w", path, name, err)
+		}
+		if _, ok := profileValues[projectProfilesKey]; ok {
+			return nil, fmt.Errorf("project file %s: profile %s cannot define profiles", path, name)
+		}
+		file.Profiles[name] = ProjectSettings{Options: options}
+	}
+
+	// The sections are decoded once the shape of the file is known to be right
+	var sections projectSections
+	if err := formatHandlers[format].Unmarshal(data, &sections); err != nil {
+		return nil, fmt.Errorf("parsing project file %s: %w", path, err)
+	}
+	file.Mappings, file.Layout = sections.Mappings, sections.Layout
+	for name, section := range sections.Profiles {
+		file.Profiles[name] = ProjectSettings{Options: file.Profiles[name].Options, Mappings: section.Mappings, Layout: section.Layout}
+	}
+
+	for name, settings := range file.allSettings() {
+		if settings.Mappings != nil {
+			if err := settings.Mappings.validate(); err != nil {
+				return nil, fmt.Errorf("project file %s: %s%w", path, name, err)
+			}
+		}
+		if settings.Layout != nil {
+			if err := settings.Layout.validate(); err != nil {
+				return nil, fmt.Errorf("project file %s: %s%w", path, name, err)
+			}
+		}
+	}
+	return file, nil
+}
+
+// allSettings returns the top-level settings and those of every profile, keyed by a prefix for
+// error messages
+func (f *ProjectFile) allSettings() map[string]ProjectSettings {
+	all := map[string]ProjectSettings{"": f.ProjectSettings}
+	for name, settings := range f.Profiles {
+		all["profile "+name+": "] = settings
+	}
+	return all
+}
+
+// Settings returns the settings of the named profile layered over the top-level settings, or
+// the top-level settings alone if profile is empty
+func (f *ProjectFile) Settings(profile string) (ProjectSettings, error) {
+	if profile == "" {
+		return f.ProjectSettings, nil
+	}
+	overlay, ok := f.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(f.Profiles))
+		for name := range f.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return ProjectSettings{}, fmt.Errorf("%w %s in %s (defined: %s)", ErrUnknownProfile, profile, f.Path, strings.Join(names, ", "))
+	}
+
+	settings := ProjectSettings{Options: make(map[string]string), Mappings: f.Mappings, Layout: f.Layout}
+	for name, value := range f.Options {
+		settings.Options[name] = value
+	}
+	for name, value := range overlay.Options {
+		settings.Options[name] = value
+	}
+	if overlay.Mappings != nil {
+		settings.Mappings = overlay.Mappings
+	}
+	if overlay.Layout != nil {
+		settings.Layout = overlay.Layout
+	}
+	return settings, nil
+}
+
+// projectOptions turns the option values of a project file into command-line values: lists
+// are joined with commas, and other sections are left out
+func projectOptions(values map[string]interface{}) (map[string]string, error) {
+	options := make(map[string]string)
+	for name, value := range values {
+		switch name {
+		case projectMappingsKey, projectLayoutKey, projectProfilesKey:
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				if _, ok := item.(map[string]interface{}); ok {
+					return nil, fmt.Errorf("option %s must be a value or a list of values", name)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			options[name] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("option %s must be a value or a list of values", name)
+		default:
+			options[name] = fmt.Sprint(v)
+		}
+	}
+	return options, nil
+}
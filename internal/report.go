@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FileStatus is what a run did with a single file
+type FileStatus string
+
+// File statuses
+const (
+	StatusConverted FileStatus = "converted" // Converted, or placed as an asset
+	StatusSkipped   FileStatus = "skipped"   // Left alone, as its output is up to date or was edited by hand
+	StatusFailed    FileStatus = "failed"
+	StatusRemoved   FileStatus = "removed" // Output removed, as its source was deleted
+)
+
+// FileReport is the outcome of a single file. The embedded FileResult holds the front matter
+// details of a converted post.
+type FileReport struct {
+	FileResult
+	Source      string
+	Destination string
+	Asset       AssetMode // How the file was placed unchanged, empty for posts
+	Status      FileStatus
+	Error       *ConversionError // Why the file failed
+	Duration    time.Duration
+	RenamedFrom string // Former source of a file renamed while watching
+}
+
+// Report is the outcome of a conversion run
+type Report struct {
+	SrcDir    string // Directory the files were found in
+	DstDir    string
+	DryRun    bool
+	Files     []FileReport       // Every file the run looked at, in the order they were found
+	Errors    []*ConversionError // Failed files, and problems found across files such as URL collisions
+	Redirects int                // Number of old URLs in the redirect map
+	Backup    string             // Archive the files were backed up to before an in-place conversion
+	Duration  time.Duration
+}
+
+// Count returns the number of files with status, posts or assets as asset says
+func (r *Report) Count(status FileStatus, asset bool) int {
+	count := 0
+	for _, file := range r.Files {
+		if file.Status == status && (file.Asset != "") == asset {
+			count++
+		}
+	}
+	return count
+}
+
+// notifyFiles passes files that are done to cfg.OnFile, if it is set
+func notifyFiles(cfg *Config, files []FileReport) {
+	if cfg.OnFile == nil {
+		return
+	}
+	for _, file := range files {
+		cfg.OnFile(file)
+	}
+}
+
+// Err returns an error summarising the errors of the run, or nil if there were none
+func (r *Report) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("encountered %d errors during conversion", len(r.Errors))
+}
+
+// ErrorCode is a stable name for the category of a ConversionError, for machine-readable reports
+type ErrorCode string
+
+// Error codes
+const (
+	CodeMalformedFrontMatter ErrorCode = "malformed-front-matter" // Front matter that cannot be parsed
+	CodeMissingFrontMatter   ErrorCode = "missing-front-matter"   // No front matter delimiters
+	CodeNotMapping           ErrorCode = "front-matter-not-mapping"
+	CodeUnsupportedFormat    ErrorCode = "unsupported-format"
+	CodeTransform            ErrorCode = "transform-failed" // A mapping rule's transform cannot be applied to a value
+	CodeURLCollision         ErrorCode = "url-collision"
+	CodeCancelled            ErrorCode = "cancelled"
+	CodeIO                   ErrorCode = "io-error" // Reading, writing or linking a file failed
+	CodeUnknown              ErrorCode = "conversion-failed"
+)
+
+// Code returns the category of the error
+func (e *ConversionError) Code() ErrorCode {
+	var (
+		parseErr *ParseError
+		pathErr  *fs.PathError
+		linkErr  *os.LinkError
+	)
+	switch {
+	case errors.Is(e.Err, ErrURLCollision):
+		return CodeURLCollision
+	case errors.Is(e.Err, context.Canceled), errors.Is(e.Err, context.DeadlineExceeded):
+		return CodeCancelled
+	case errors.As(e.Err, &parseErr):
+		return CodeMalformedFrontMatter
+	case errors.Is(e.Err, ErrInvalidMarkdown):
+		return CodeMissingFrontMatter
+	case errors.Is(e.Err, ErrNotMapping):
+		return CodeNotMapping
+	case errors.Is(e.Err, ErrUnsupportedFormat):
+		return CodeUnsupportedFormat
+	case errors.Is(e.Err, ErrTransformValue):
+		return CodeTransform
+	case errors.As(e.Err, &pathErr), errors.As(e.Err, &linkErr):
+		return CodeIO
+	}
+	return CodeUnknown
+}
@@ -0,0 +1,338 @@
+package internal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReportFormat is the format of a machine-readable run report
+type ReportFormat string
+
+// Report formats
+const (
+	ReportJSON  ReportFormat = "json"  // A single JSON document, written when the run ends
+	ReportJSONL ReportFormat = "jsonl" // A JSON Lines event log, one line per file as it is done and a summary line
+	ReportJUnit ReportFormat = "junit" // JUnit XML with a testcase per file, written when the run ends
+)
+
+// ReportFormatFor infers the report format from a file name
+func ReportFormatFor(file string) ReportFormat {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jsonl", ".ndjson":
+		return ReportJSONL
+	case ".xml":
+		return ReportJUnit
+	}
+	return ReportJSON
+}
+
+// ReportWriter writes a machine-readable report of a run. In JSON Lines format, each file is
+// written as soon as it is passed to File; the other formats are written by Finish.
+type ReportWriter struct {
+	w      io.Writer
+	format ReportFormat
+	mu     sync.Mutex
+	err    error // First error writing an event
+}
+
+// NewReportWriter creates a ReportWriter that writes to w in format
+func NewReportWriter(w io.Writer, format ReportFormat) (*ReportWriter, error) {
+	switch format {
+	case ReportJSON, ReportJSONL, ReportJUnit:
+		return &ReportWriter{w: w, format: format}, nil
+	}
+	return nil, fmt.Errorf("%w: report format %s", ErrUnsupportedFormat, format)
+}
+
+// Streaming reports whether files are written as they are done, so the report needs no Finish
+func (rw *ReportWriter) Streaming() bool {
+	return rw.format == ReportJSONL
+}
+
+// File writes the event of a file that is done in JSON Lines format, and does nothing otherwise.
+// It is safe for concurrent use; errors are returned by Finish.
+func (rw *ReportWriter) File(file FileReport) {
+	if !rw.Streaming() {
+		return
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.err == nil {
+		rw.err = json.NewEncoder(rw.w).Encode(jsonFileEvent{Event: "file", jsonFile: newJSONFile(file)})
+	}
+}
+
+// Finish writes the report of a completed run: the summary line of a JSON Lines log, or the
+// whole report in the other formats
+func (rw *ReportWriter) Finish(report *Report) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.err != nil {
+		return rw.err
+	}
+
+	switch rw.format {
+	case ReportJSONL:
+		return json.NewEncoder(rw.w).Encode(jsonSummaryEvent{Event: "summary", jsonSummary: newJSONSummary(report)})
+	case ReportJUnit:
+		if _, err := io.WriteString(rw.w, xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(rw.w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(newJUnitSuites(report)); err != nil {
+			return err
+		}
+		_, err := io.WriteString(rw.w, "\n")
+		return err
+	default:
+		doc := jsonReport{
+			SrcDir:      report.SrcDir,
+			DstDir:      report.DstDir,
+			DryRun:      report.DryRun,
+			jsonSummary: newJSONSummary(report),
+			Files:       make([]*jsonFile, len(report.Files)),
+		}
+		for i, file := range report.Files {
+			doc.Files[i] = newJSONFile(file)
+		}
+		enc := json.NewEncoder(rw.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+}
+
+// jsonReport is the JSON document of a run
+type jsonReport struct {
+	SrcDir string `json:"src_dir"`
+	DstDir string `json:"dst_dir"`
+	DryRun bool   `json:"dry_run"`
+	*jsonSummary
+	Files []*jsonFile `json:"files"`
+}
+
+// jsonFileEvent is a line of a JSON Lines report for a file that is done
+type jsonFileEvent struct {
+	Event string `json:"event"`
+	*jsonFile
+}
+
+// jsonSummaryEvent is the last line of a JSON Lines report
+type jsonSummaryEvent struct {
+	Event string `json:"event"`
+	*jsonSummary
+}
+
+// jsonSummary counts the files of a run by status, and lists its errors
+type jsonSummary struct {
+	Converted  int         `json:"converted"`
+	Skipped    int         `json:"skipped"`
+	Failed     int         `json:"failed"`
+	Removed    int         `json:"removed"`
+	Redirects  int         `json:"redirects,omitempty"`
+	Backup     string      `json:"backup,omitempty"`
+	DurationMS float64     `json:"duration_ms"`
+	Errors     []jsonError `json:"errors"`
+}
+
+// jsonFile is a file of a run
+type jsonFile struct {
+	Source      string      `json:"source"`
+	Destination string      `json:"destination"`
+	Status      FileStatus  `json:"status"`
+	Asset       AssetMode   `json:"asset,omitempty"`
+	Format      Format      `json:"format,omitempty"`
+	Renamed     []KeyRename `json:"renamed,omitempty"`
+	Added       []string    `json:"added,omitempty"`
+	Removed     []string    `json:"removed,omitempty"`
+	Warnings    []Warning   `json:"warnings,omitempty"`
+	Error       *jsonError  `json:"error,omitempty"`
+	RenamedFrom string      `json:"renamed_from,omitempty"`
+	DurationMS  float64     `json:"duration_ms"`
+	OldURL      string      `json:"old_url,omitempty"`
+	NewURL      string      `json:"new_url,omitempty"`
+}
+
+// jsonError is a ConversionError with its code
+type jsonError struct {
+	Code    ErrorCode `json:"code"`
+	Source  string    `json:"source"`
+	Line    int       `json:"line,omitempty"`
+	Message string    `json:"message"`
+}
+
+// newJSONSummary summarises a run for a JSON report
+func newJSONSummary(report *Report) *jsonSummary {
+	summary := &jsonSummary{
+		Redirects:  report.Redirects,
+		Backup:     report.Backup,
+		DurationMS: milliseconds(report.Duration),
+		Errors:     make([]jsonError, len(report.Errors)),
+	}
+	for _, file := range report.Files {
+		switch file.Status {
+		case StatusConverted:
+			summary.Converted++
+		case StatusSkipped:
+			summary.Skipped++
+		case StatusFailed:
+			summary.Failed++
+		case StatusRemoved:
+			summary.Removed++
+		}
+	}
+	for i, err := range report.Errors {
+		summary.Errors[i] = *newJSONError(err)
+	}
+	return summary
+}
+
+// newJSONFile converts a file for a JSON report
+func newJSONFile(file FileReport) *jsonFile {
+	return &jsonFile{
+		Source:      file.Source,
+		Destination: file.Destination,
+		Status:      file.Status,
+		Asset:       file.Asset,
+		Format:      file.Format,
+		Renamed:     file.Renamed,
+		Added:       file.Added,
+		Removed:     file.Removed,
+		Warnings:    file.Warnings,
+		Error:       newJSONError(file.Error),
+		RenamedFrom: file.RenamedFrom,
+		DurationMS:  milliseconds(file.Duration),
+		OldURL:      file.OldURL,
+		NewURL:      file.NewURL,
+	}
+}
+
+// newJSONError converts an error for a JSON report, nil if there is none
+func newJSONError(err *ConversionError) *jsonError {
+	if err == nil {
+		return nil
+	}
+	return &jsonError{Code: err.Code(), Source: err.SourceFile, Line: err.Line, Message: err.Err.Error()}
+}
+
+// milliseconds returns a duration in fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// junitSuites is the root of a JUnit XML report, with a single suite for the run
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+// junitSuite is the suite of a run
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+// junitCase is a single file of the run
+type junitCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Time      string         `xml:"time,attr"`
+	Failures  []junitFailure `xml:"failure"`
+	Skipped   *junitSkipped  `xml:"skipped"`
+	SystemOut string         `xml:"system-out,omitempty"`
+}
+
+// junitFailure is an error of a file, typed by its code
+type junitFailure struct {
+	Type    ErrorCode `xml:"type,attr"`
+	Message string    `xml:"message,attr"`
+	Text    string    `xml:",chardata"`
+}
+
+// junitSkipped marks a file the run skipped
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// newJUnitSuites builds the JUnit report of a run. Each file is a testcase named by its path
+// relative to the source directory; errors found across files, such as URL collisions, fail
+// the testcases of the files they name.
+func newJUnitSuites(report *Report) junitSuites {
+	suite := junitSuite{Name: "h2h", Time: seconds(report.Duration)}
+	index := make(map[string]int)
+	for _, file := range report.Files {
+		name, err := filepath.Rel(report.SrcDir, file.Source)
+		if err != nil {
+			name = file.Source
+		}
+		tc := junitCase{Name: filepath.ToSlash(name), ClassName: "h2h", Time: seconds(file.Duration)}
+		switch file.Status {
+		case StatusSkipped:
+			tc.Skipped = &junitSkipped{}
+			if len(file.Warnings) > 0 {
+				tc.Skipped.Message = file.Warnings[0].Message
+			}
+		case StatusRemoved:
+			tc.Skipped = &junitSkipped{Message: "source was deleted; removed " + file.Destination}
+		}
+		var out strings.Builder
+		for _, warning := range file.Warnings {
+			if warning.Line > 0 {
+				fmt.Fprintf(&out, "warning: line %d: %s\n", warning.Line, warning.Message)
+			} else {
+				fmt.Fprintf(&out, "warning: %s\n", warning.Message)
+			}
+		}
+		tc.SystemOut = out.String()
+		index[file.Source] = len(suite.Cases)
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	for _, err := range report.Errors {
+		i, ok := index[err.SourceFile]
+		if !ok {
+			i = len(suite.Cases)
+			suite.Cases = append(suite.Cases, junitCase{Name: filepath.ToSlash(err.SourceFile), ClassName: "h2h", Time: seconds(0)})
+			index[err.SourceFile] = i
+		}
+		suite.Cases[i].Failures = append(suite.Cases[i].Failures, junitFailure{Type: err.Code(), Message: err.Err.Error(), Text: err.Error()})
+	}
+
+	for _, tc := range suite.Cases {
+		suite.Tests++
+		switch {
+		case len(tc.Failures) > 0:
+			suite.Failures++
+		case tc.Skipped != nil:
+			suite.Skipped++
+		}
+	}
+	return junitSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	}
+}
+
+// seconds formats a duration in seconds, as JUnit reports times
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,405 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// hugoShortcodeNamePattern matches the name of a Hugo shortcode, which may be a path such as blog/note
+var hugoShortcodeNamePattern = regexp.MustCompile(`^[\w./-]+`)
+
+// hugoPairedShortcodes are the Hugo shortcodes that always enclose content up to a matching
+// {{< /name >}}. Other shortcodes are treated as paired when such a closing shortcode follows them.
+var hugoPairedShortcodes = map[string]bool{
+	"highlight": true,
+	"notice":    true,
+}
+
+// hugoShortcode is a Hugo shortcode found in a Markdown body
+type hugoShortcode struct {
+	name     string
+	args     []string          // Positional parameters
+	params   map[string]string // Named parameters
+	inner    string            // Enclosed content of a paired shortcode
+	markdown bool              // Written as {{% %}}, so the inner content is Markdown
+	line     int
+}
+
+// param returns the named parameter, falling back to the positional parameter at index
+func (sc hugoShortcode) param(name string, index int) string {
+	if value, ok := sc.params[name]; ok {
+		return value
+	}
+	if index >= 0 && index < len(sc.args) {
+		return sc.args[index]
+	}
+	return ""
+}
+
+// hugoShortcodeToken is an opening, closing or self-closing shortcode located in a body
+type hugoShortcodeToken struct {
+	start, end  int
+	name        string
+	params      string
+	closing     bool // {{< /name >}}
+	selfClosing bool // {{< name />}}
+	markdown    bool
+	comment     bool // Escaped as {{</* name */>}}, which Hugo renders literally
+}
+
+// hugoShortcodeConverter rewrites a Hugo shortcode as a Hexo tag plugin or HTML. It reports
+// false if the shortcode's parameters have no Hexo equivalent.
+type hugoShortcodeConverter func(sc hugoShortcode) (string, bool)
+
+// hugoShortcodeConverters maps Hugo shortcode names to their converters
+var hugoShortcodeConverters = map[string]hugoShortcodeConverter{
+	"figure":    convertFigure,
+	"highlight": convertHighlight,
+	"ref":       convertRef,
+	"relref":    convertRef,
+	"youtube":   convertYouTubeShortcode,
+	"vimeo":     convertVimeoShortcode,
+	"gist":      convertGistShortcode,
+	"notice":    convertNotice,
+}
+
+// convertHugoShortcodes rewrites the Hugo shortcodes in a Markdown body as Hexo tag plugins or
+// HTML. Both {{< >}} and {{% %}} forms are handled, paired or self-closing. Shortcodes that
+// cannot be converted are kept verbatim and reported. startLine is the file line on which
+// body begins.
+func convertHugoShortcodes(body string, startLine int) (string, []Warning) {
+	tokens := scanShortcodes(body)
+	if len(tokens) == 0 {
+		return body, nil
+	}
+
+	var (
+		out      strings.Builder
+		warnings []Warning
+		last     int
+		kept     = make(map[int]bool) // Closing shortcodes of pairs kept verbatim, whose content is still converted
+	)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if kept[i] {
+			continue
+		}
+		line := startLine + strings.Count(body[:token.start], "\n")
+		delims := shortcodeDelims(token.markdown)
+
+		switch {
+		case token.comment:
+			// Hexo would read the literal shortcode as a template, so keep it raw
+			out.WriteString(body[last:token.start])
+			fmt.Fprintf(&out, "{%% raw %%}%s %s%s %s{%% endraw %%}", delims[0], token.name, token.params, delims[1])
+			last = token.end
+			continue
+		case token.closing:
+			warnings = append(warnings, Warning{Line: line, Message: fmt.Sprintf("unmatched Hugo shortcode %s /%s %s", delims[0], token.name, delims[1])})
+			continue
+		}
+
+		args, params := parseShortcodeParams(token.params)
+		sc := hugoShortcode{name: token.name, args: args, params: params, markdown: token.markdown, line: line}
+		end := token.end
+
+		closing := -1
+		if !token.selfClosing {
+			closing = closingShortcode(tokens, i)
+		}
+		if closing < 0 && hugoPairedShortcodes[sc.name] && !token.selfClosing {
+			warnings = append(warnings, Warning{Line: line, Message: fmt.Sprintf("Hugo shortcode %s %s %s has no %s /%s %s", delims[0], sc.name, delims[1], delims[0], sc.name, delims[1])})
+			continue
+		}
+		if closing >= 0 {
+			sc.inner = body[token.end:tokens[closing].start]
+			end = tokens[closing].end
+		}
+
+		convert, ok := hugoShortcodeConverters[sc.name]
+		if !ok {
+			warnings = append(warnings, Warning{Line: line, Message: fmt.Sprintf("unsupported Hugo shortcode %s %s %s", delims[0], sc.name, delims[1])})
+			kept[closing] = true
+			continue
+		}
+		converted, ok := convert(sc)
+		if !ok {
+			warnings = append(warnings, Warning{Line: line, Message: fmt.Sprintf("cannot convert Hugo shortcode %s", body[token.start:token.end])})
+			kept[closing] = true
+			continue
+		}
+
+		out.WriteString(body[last:token.start])
+		out.WriteString(converted)
+		last = end
+		if closing >= 0 {
+			i = closing
+		}
+	}
+	out.WriteString(body[last:])
+	return out.String(), warnings
+}
+
+// shortcodeDelims returns the opening and closing delimiters of a shortcode
+func shortcodeDelims(markdown bool) [2]string {
+	if markdown {
+		return [2]string{"{{%", "%}}"}
+	}
+	return [2]string{"{{<", ">}}"}
+}
+
+// scanShortcodes locates the shortcodes in a body, in order
+func scanShortcodes(body string) []hugoShortcodeToken {
+	var tokens []hugoShortcodeToken
+	for offset := 0; ; {
+		start := strings.Index(body[offset:], "{{")
+		if start < 0 {
+			return tokens
+		}
+		start += offset
+		token, ok := scanShortcode(body, start)
+		if !ok {
+			offset = start + 2
+			continue
+		}
+		tokens = append(tokens, token)
+		offset = token.end
+	}
+}
+
+// scanShortcode reads the shortcode starting at body[start], reporting false if there is none
+func scanShortcode(body string, start int) (hugoShortcodeToken, bool) {
+	rest := body[start+2:]
+	if rest == "" || (rest[0] != '<' && rest[0] != '%') {
+		return hugoShortcodeToken{}, false
+	}
+	token := hugoShortcodeToken{start: start, markdown: rest[0] == '%'}
+	closeDelim := shortcodeDelims(token.markdown)[1]
+	inner := strings.TrimLeft(rest[1:], " \t")
+
+	if strings.HasPrefix(inner, "/*") {
+		end := strings.Index(inner, "*/"+closeDelim)
+		if end < 0 {
+			return hugoShortcodeToken{}, false
+		}
+		token.comment = true
+		if name, params, ok := strings.Cut(strings.TrimSpace(inner[2:end]), " "); ok {
+			token.name, token.params = name, " "+params
+		} else {
+			token.name = name
+		}
+		token.end = start + 2 + len(rest) - len(inner) + end + len("*/"+closeDelim)
+		return token, true
+	}
+
+	if strings.HasPrefix(inner, "/") {
+		token.closing = true
+		inner = strings.TrimLeft(inner[1:], " \t")
+	}
+	token.name = hugoShortcodeNamePattern.FindString(inner)
+	if token.name == "" {
+		return hugoShortcodeToken{}, false
+	}
+
+	// Find the closing delimiter outside quoted parameters
+	var quote byte
+	for i := len(token.name); i < len(inner); i++ {
+		switch c := inner[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case strings.HasPrefix(inner[i:], closeDelim):
+			params := strings.TrimRight(inner[len(token.name):i], " \t")
+			if strings.HasSuffix(params, "/") {
+				token.selfClosing = true
+				params = strings.TrimRight(strings.TrimSuffix(params, "/"), " \t")
+			}
+			token.params = params
+			token.end = start + 2 + len(rest) - len(inner) + i + len(closeDelim)
+			return token, true
+		}
+	}
+	return hugoShortcodeToken{}, false
+}
+
+// closingShortcode returns the index of the token that closes the shortcode at tokens[open],
+// honoring nested shortcodes of the same name, or -1 if it is not closed
+func closingShortcode(tokens []hugoShortcodeToken, open int) int {
+	name := tokens[open].name
+	depth := 0
+	for i := open + 1; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.name != name || token.comment || token.selfClosing {
+			continue
+		}
+		switch {
+		case !token.closing:
+			depth++
+		case depth == 0:
+			return i
+		default:
+			depth--
+		}
+	}
+	return -1
+}
+
+// parseShortcodeParams splits shortcode parameters into positional and named ones.
+// Values may be bare, "quoted" or `raw`.
+func parseShortcodeParams(s string) ([]string, map[string]string) {
+	var (
+		args   []string
+		params = make(map[string]string)
+	)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		var name string
+		if eq := strings.IndexByte(s, '='); eq > 0 && !strings.ContainsAny(s[:eq], " \t\"`") {
+			name, s = s[:eq], s[eq+1:]
+		}
+
+		if s == "" {
+			params[name] = "" // A name with an empty value, as in src=
+			break
+		}
+
+		var value string
+		switch quote := s[0]; quote {
+		case '"', '`':
+			end := strings.IndexByte(s[1:], quote)
+			if end < 0 {
+				end = len(s) - 1
+			}
+			value, s = s[1:end+1], s[min(end+2, len(s)):]
+			if quote == '"' {
+				value = strings.ReplaceAll(value, `\"`, `"`)
+			}
+		default:
+			end := strings.IndexAny(s, " \t\n")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+
+		if name != "" {
+			params[name] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+	return args, params
+}
+
+// convertFigure converts {{< figure src="..." >}} to a Markdown image, or to an HTML figure
+// when it has a caption or link
+func convertFigure(sc hugoShortcode) (string, bool) {
+	src := sc.param("src", 0)
+	if src == "" {
+		return "", false
+	}
+	alt, title := sc.param("alt", -1), sc.param("title", -1)
+	caption, link := sc.param("caption", -1), sc.param("link", -1)
+
+	if caption == "" && link == "" {
+		if title != "" {
+			return fmt.Sprintf("![%s](%s %q)", alt, src, title), true
+		}
+		return fmt.Sprintf("![%s](%s)", alt, src), true
+	}
+
+	img := fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(src), html.EscapeString(alt))
+	if link != "" {
+		img = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link), img)
+	}
+	var sb strings.Builder
+	sb.WriteString("<figure>" + img)
+	if title != "" || caption != "" {
+		sb.WriteString("<figcaption>")
+		if title != "" {
+			sb.WriteString("<h4>" + html.EscapeString(title) + "</h4>")
+		}
+		if caption != "" {
+			sb.WriteString("<p>" + caption + "</p>")
+		}
+		sb.WriteString("</figcaption>")
+	}
+	sb.WriteString("</figure>")
+	return sb.String(), true
+}
+
+// convertHighlight converts {{< highlight lang >}} to Hexo's codeblock tag
+func convertHighlight(sc hugoShortcode) (string, bool) {
+	open := "{% codeblock %}"
+	if lang := sc.param("lang", 0); lang != "" {
+		open = fmt.Sprintf("{%% codeblock lang:%s %%}", lang)
+	}
+	return fmt.Sprintf("%s\n%s\n{%% endcodeblock %%}", open, trimBlockContent(sc.inner)), true
+}
+
+// convertRef converts {{< ref "path" >}} to Hexo's post_path tag, which links a post by its file name
+func convertRef(sc hugoShortcode) (string, bool) {
+	target, _, _ := strings.Cut(sc.param("path", 0), "#")
+	target = strings.TrimSuffix(target, "/")
+	if target == "" {
+		return "", false
+	}
+
+	slug := strings.TrimSuffix(path.Base(target), path.Ext(target))
+	if slug == "index" || slug == "_index" {
+		slug = path.Base(path.Dir(target))
+	}
+	if slug == "." || slug == "/" {
+		return "", false
+	}
+	return fmt.Sprintf("{%% post_path %s %%}", slug), true
+}
+
+// convertYouTubeShortcode converts {{< youtube id >}} to Hexo's youtube tag
+func convertYouTubeShortcode(sc hugoShortcode) (string, bool) {
+	id := sc.param("id", 0)
+	if id == "" {
+		return "", false
+	}
+	return fmt.Sprintf("{%% youtube %s %%}", id), true
+}
+
+// convertVimeoShortcode converts {{< vimeo id >}} to Hexo's vimeo tag
+func convertVimeoShortcode(sc hugoShortcode) (string, bool) {
+	id := sc.param("id", 0)
+	if id == "" {
+		return "", false
+	}
+	return fmt.Sprintf("{%% vimeo %s %%}", id), true
+}
+
+// convertGistShortcode converts {{< gist user id [file] >}} to Hexo's gist tag
+func convertGistShortcode(sc hugoShortcode) (string, bool) {
+	user, id := sc.param("user", 0), sc.param("id", 1)
+	if user == "" || id == "" {
+		return "", false
+	}
+	args := user + "/" + id
+	if file := sc.param("file", 2); file != "" {
+		args += " " + file
+	}
+	return fmt.Sprintf("{%% gist %s %%}", args), true
+}
+
+// convertNotice converts {{% notice type [title] %}} to the note tag supported by common Hexo themes
+func convertNotice(sc hugoShortcode) (string, bool) {
+	kind := sc.param("type", 0)
+	if kind == "" {
+		kind = "info"
+	}
+	inner := strings.TrimSpace(sc.inner)
+	if title := sc.param("title", 1); title != "" {
+		inner = "**" + title + "**\n\n" + inner
+	}
+	return fmt.Sprintf("{%% note %s %%}\n%s\n{%% endnote %%}", kind, inner), true
+}
@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// permalinkTokenPattern matches a token of a Hexo or Hugo permalink, such as :year
+var permalinkTokenPattern = regexp.MustCompile(`:(\w+)`)
+
+// hexoPermalinkTokens maps Hexo permalink tokens to their Hugo equivalents
+var hexoPermalinkTokens = map[string]string{
+	"year":       "year",
+	"month":      "month",
+	"day":        "day",
+	"title":      "slugorfilename", // Hexo's :title is the file name unless the post sets a permalink, which becomes its slug
+	"name":       "filename",
+	"post_title": "title",
+}
+
+// hugoPermalinkTokens maps Hugo permalink tokens to their Hexo equivalents
+var hugoPermalinkTokens = map[string]string{
+	"year":                  "year",
+	"month":                 "month",
+	"day":                   "day",
+	"slug":                  "title",
+	"slugorfilename":        "title",
+	"slugorcontentbasename": "title",
+	"filename":              "name",
+	"contentbasename":       "name",
+	"title":                 "post_title",
+}
+
+// siteSetting translates one setting of a site configuration. apply writes the translated
+// setting into out and returns a note if the value could not be fully translated.
+type siteSetting struct {
+	from  string
+	apply func(src, out, value *yaml.Node) siteNote
+}
+
+// siteNote explains a setting that could not be fully translated. A note about a setting that
+// was written to the output is attached to it as a comment; the others are listed at the top.
+type siteNote struct {
+	text string
+	to   string // Key path of the output setting the note is about, if any
+}
+
+// hexoSiteSettings translate Hexo's _config.yml into a Hugo configuration
+var hexoSiteSettings = []siteSetting{
+	{"title", copySetting("title")},
+	{"subtitle", copySetting("params.subtitle")},
+	{"description", copySetting("params.description")},
+	{"keywords", copySetting("params.keywords")},
+	{"author", copySetting("params.author")},
+	{"url", hexoURLSetting},
+	{"root", func(_, _, _ *yaml.Node) siteNote { return siteNote{} }}, // Folded into baseURL
+	{"permalink", permalinkSetting("permalinks.posts", hexoPermalinkTokens, "/")},
+	{"timezone", copySetting("timeZone")},
+	{"language", hexoLanguageSetting},
+	{"per_page", hexoPerPageSetting},
+	{"pagination_dir", copySetting("pagination.path")},
+	{"tag_dir", hexoTaxonomySetting("tag", "tags")},
+	{"category_dir", hexoTaxonomySetting("category", "categories")},
+	{"new_post_name", hexoNewPostNameSetting},
+}
+
+// hugoSiteSettings translate a Hugo configuration into Hexo's _config.yml
+var hugoSiteSettings = []siteSetting{
+	{"title", copySetting("title")},
+	{"params.subtitle", copySetting("subtitle")},
+	{"params.description", copySetting("description")},
+	{"params.keywords", copySetting("keywords")},
+	{"params.author", copySetting("author")},
+	{"baseURL", hugoBaseURLSetting},
+	{"permalinks.posts", permalinkSetting("permalink", hugoPermalinkTokens, "")},
+	{"permalinks.page.posts", permalinkSetting("permalink", hugoPermalinkTokens, "")},
+	{"timeZone", copySetting("timezone")},
+	{"languageCode", copySetting("language")},
+	{"paginate", copySetting("per_page")},
+	{"pagination.pagerSize", copySetting("per_page")},
+	{"paginatePath", copySetting("pagination_dir")},
+	{"pagination.path", copySetting("pagination_dir")},
+	{"taxonomies.tag", copySetting("tag_dir")},
+	{"taxonomies.category", copySetting("category_dir")},
+	{"permalinks.tags", hugoTaxonomyPermalinkSetting("tag_dir")},
+	{"permalinks.categories", hugoTaxonomyPermalinkSetting("category_dir")},
+}
+
+// ConvertSiteConfig translates a site configuration for the conversion direction in cfg:
+// Hexo's _config.yml to a Hugo configuration, or the reverse for hugo2hexo. The result is
+// written in cfg.TargetFormat. Settings that cannot be fully translated are returned as notes,
+// and noted in YAML and TOML output: in a comment above the setting if it was written, or in a
+// comment at the top otherwise.
+func ConvertSiteConfig(data []byte, sourceFormat Format, cfg *Config) ([]byte, []string, error) {
+	sourceHandler, ok := formatHandlers[sourceFormat]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, sourceFormat)
+	}
+	targetHandler, err := handlerFor(cfg.TargetFormat, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc yaml.Node
+	if err := sourceHandler.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("parsing site configuration: %w", err)
+	}
+	src, err := frontMatterMapping(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, from, to := hexoSiteSettings, "Hexo", "Hugo"
+	if cfg.ConversionDirection == DirectionHugoToHexo {
+		settings, from, to = hugoSiteSettings, "Hugo", "Hexo"
+	}
+
+	out := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	translated := make(map[*yaml.Node]bool)
+	var notes, listed []string
+	for _, setting := range settings {
+		path, err := parseKeyPath(setting.from)
+		if err != nil {
+			return nil, nil, err
+		}
+		loc, ok := lookupPath(src, path)
+		if !ok {
+			continue
+		}
+		translated[loc.value] = true
+		note := setting.apply(src, out, resolveAlias(loc.value))
+		if note.text == "" {
+			continue
+		}
+		text := fmt.Sprintf("%s: %s", setting.from, note.text)
+		notes = append(notes, text)
+		if !attachNote(out, note.to, text) {
+			listed = append(listed, text)
+		}
+	}
+	untranslated := untranslatedSettings(src, "", translated)
+	notes = append(notes, untranslated...)
+	listed = append(listed, untranslated...)
+
+	outDoc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{out}}
+	if len(listed) > 0 {
+		outDoc.HeadComment = fmt.Sprintf("%s settings without a %s equivalent:", from, to)
+		for _, note := range listed {
+			outDoc.HeadComment += "\n" + note
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := targetHandler.Marshal(&buf, outDoc); err != nil {
+		return nil, nil, fmt.Errorf("marshaling site configuration: %w", err)
+	}
+	return buf.Bytes(), notes, nil
+}
+
+// attachNote writes a note as a comment above the output setting at the key path to, and
+// reports whether that setting exists
+func attachNote(out *yaml.Node, to, note string) bool {
+	if to == "" {
+		return false
+	}
+	path, err := parseKeyPath(to)
+	if err != nil {
+		panic(err) // Setting paths are constants
+	}
+	loc, ok := lookupPath(out, path)
+	if !ok || loc.key == nil {
+		return false
+	}
+	loc.key.HeadComment = note
+	return true
+}
+
+// untranslatedSettings lists the settings under mapping that were not translated. Mappings of
+// which some settings were translated are listed setting by setting.
+func untranslatedSettings(mapping *yaml.Node, prefix string, translated map[*yaml.Node]bool) []string {
+	var notes []string
+	for _, pair := range mappingPairs(mapping, nil) {
+		value := resolveAlias(pair.value)
+		key := prefix + pair.key.Value
+		switch {
+		case translated[pair.value]:
+		case value.Kind == yaml.MappingNode && containsTranslated(value, translated):
+			notes = append(notes, untranslatedSettings(value, key+".", translated)...)
+		case value.Kind == yaml.ScalarNode && value.Tag != tagNull:
+			notes = append(notes, fmt.Sprintf("%s: %s", key, value.Value))
+		default:
+			notes = append(notes, key)
+		}
+	}
+	return notes
+}
+
+// containsTranslated reports whether a setting nested in node was translated
+func containsTranslated(node *yaml.Node, translated map[*yaml.Node]bool) bool {
+	for _, child := range node.Content {
+		if translated[child] || containsTranslated(resolveAlias(child), translated) {
+			return true
+		}
+	}
+	return false
+}
+
+// setSetting stores a copy of value at the key path to under out
+func setSetting(out *yaml.Node, to string, value *yaml.Node) {
+	path, err := parseKeyPath(to)
+	if err != nil {
+		panic(err) // Setting paths are constants
+	}
+	value = cloneNode(value)
+	value.HeadComment, value.LineComment, value.FootComment = "", "", ""
+	if err := setPath(out, path, nil, value); err != nil {
+		panic(err) // Setting paths name no list indexes
+	}
+}
+
+// copySetting returns a setting translation that copies the value to another key path
+func copySetting(to string) func(src, out, value *yaml.Node) siteNote {
+	return func(_, out, value *yaml.Node) siteNote {
+		setSetting(out, to, value)
+		return siteNote{}
+	}
+}
+
+// permalinkSetting returns a setting translation that rewrites the tokens of a permalink
+func permalinkSetting(to string, tokens map[string]string, leading string) func(src, out, value *yaml.Node) siteNote {
+	return func(_, out, value *yaml.Node) siteNote {
+		var unknown []string
+		permalink := permalinkTokenPattern.ReplaceAllStringFunc(value.Value, func(token string) string {
+			mapped, ok := tokens[token[1:]]
+			if !ok {
+				unknown = append(unknown, token)
+				return token
+			}
+			return ":" + mapped
+		})
+		if len(unknown) > 0 {
+			return siteNote{text: fmt.Sprintf("%s (no equivalent for %s)", value.Value, strings.Join(unknown, ", "))}
+		}
+
+		permalink = leading + strings.TrimPrefix(permalink, "/")
+		setSetting(out, to, scalarNode(tagString, permalink))
+		return siteNote{}
+	}
+}
+
+// hexoURLSetting translates Hexo's url and root settings into Hugo's baseURL
+func hexoURLSetting(src, out, value *yaml.Node) siteNote {
+	baseURL := strings.TrimSuffix(value.Value, "/")
+	if _, root, ok := childNode(src, pathSegment{key: "root", index: -1}); ok {
+		if path := strings.Trim(root.Value, "/"); path != "" && !strings.HasSuffix(baseURL, "/"+path) {
+			baseURL += "/" + path
+		}
+	}
+	setSetting(out, "baseURL", scalarNode(tagString, baseURL+"/"))
+	return siteNote{}
+}
+
+// hexoNewPostNameSetting notes Hexo's new_post_name, the file name pattern of new posts. Hugo
+// takes the path of new content from the hugo new content command, and its front matter from archetypes.
+func hexoNewPostNameSetting(_, _, value *yaml.Node) siteNote {
+	return siteNote{text: fmt.Sprintf("%s (Hugo names a new post after the path given to hugo new content, such as posts/my-post.md; set its front matter in archetypes/default.md)", value.Value)}
+}
+
+// hexoLanguageSetting translates Hexo's language, which may list several languages, into Hugo's languageCode
+func hexoLanguageSetting(_, out, value *yaml.Node) siteNote {
+	if value.Kind == yaml.SequenceNode {
+		if len(value.Content) == 0 {
+			return siteNote{}
+		}
+		setSetting(out, "languageCode", value.Content[0])
+		if len(value.Content) > 1 {
+			return siteNote{text: "only the first language is used; configure the others under languages", to: "languageCode"}
+		}
+		return siteNote{}
+	}
+	setSetting(out, "languageCode", value)
+	return siteNote{}
+}
+
+// hexoPerPageSetting translates Hexo's per_page into Hugo's pager size. Hugo cannot disable pagination.
+func hexoPerPageSetting(_, out, value *yaml.Node) siteNote {
+	if strings.TrimSpace(value.Value) == "0" {
+		return siteNote{text: "0 (Hugo cannot disable pagination)"}
+	}
+	setSetting(out, "pagination.pagerSize", value)
+	return siteNote{}
+}
+
+// hexoTaxonomySetting returns a setting translation for Hexo's tag_dir or category_dir. Hugo reads
+// taxonomy terms from the front matter key named after the taxonomy, so the taxonomy keeps its
+// default name and a different directory is set through its permalink.
+func hexoTaxonomySetting(singular, plural string) func(src, out, value *yaml.Node) siteNote {
+	return func(_, out, value *yaml.Node) siteNote {
+		setSetting(out, "taxonomies."+singular, scalarNode(tagString, plural))
+		if dir := strings.Trim(value.Value, "/"); dir != plural {
+			setSetting(out, "permalinks."+plural, scalarNode(tagString, "/"+dir+"/:slug/"))
+		}
+		return siteNote{}
+	}
+}
+
+// hugoBaseURLSetting translates Hugo's baseURL into Hexo's url and root settings
+func hugoBaseURLSetting(_, out, value *yaml.Node) siteNote {
+	setSetting(out, "url", scalarNode(tagString, strings.TrimSuffix(value.Value, "/")))
+	if parsed, err := url.Parse(value.Value); err == nil && strings.Trim(parsed.Path, "/") != "" {
+		setSetting(out, "root", scalarNode(tagString, "/"+strings.Trim(parsed.Path, "/")+"/"))
+	}
+	return siteNote{}
+}
+
+// hugoTaxonomyPermalinkSetting returns a setting translation that reads Hexo's tag_dir or
+// category_dir from a taxonomy permalink such as /t/:slug/
+func hugoTaxonomyPermalinkSetting(to string) func(src, out, value *yaml.Node) siteNote {
+	return func(_, out, value *yaml.Node) siteNote {
+		dir, rest, _ := strings.Cut(strings.Trim(value.Value, "/"), "/")
+		if dir == "" || strings.HasPrefix(dir, ":") || (rest != ":slug" && rest != ":title") {
+			return siteNote{text: value.Value}
+		}
+		setSetting(out, to, scalarNode(tagString, dir))
+		return siteNote{}
+	}
+}
@@ -0,0 +1,419 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// hexoTagPattern matches a Hexo tag plugin such as {% asset_img a.png Title %}
+var hexoTagPattern = regexp.MustCompile(`\{%-?\s*(\w+)([^\n]*?)-?%\}`)
+
+// hexoBlockTags are the Hexo tag plugins that always enclose content up to a matching
+// {% end<name> %}. Other tags are treated as block tags when such an end tag follows them.
+var hexoBlockTags = map[string]bool{
+	"codeblock":  true,
+	"code":       true,
+	"blockquote": true,
+	"quote":      true,
+	"pullquote":  true,
+	"raw":        true,
+}
+
+// hexoTag is a Hexo tag plugin found in a Markdown body
+type hexoTag struct {
+	name    string
+	args    []string
+	content string // Enclosed content of a block tag
+	line    int
+}
+
+// hexoTagConverter rewrites a Hexo tag plugin as Hugo Markdown. It reports false if the
+// tag's arguments have no Hugo equivalent.
+type hexoTagConverter func(tag hexoTag) (string, bool)
+
+// hexoTagConverters maps Hexo tag plugin names to their converters
+var hexoTagConverters = map[string]hexoTagConverter{
+	"asset_img":  convertAssetImg,
+	"asset_link": convertAssetLink,
+	"asset_path": convertAssetPath,
+	"codeblock":  convertCodeBlock,
+	"code":       convertCodeBlock,
+	"blockquote": convertBlockquote,
+	"quote":      convertBlockquote,
+	"pullquote":  convertPullquote,
+	"raw":        convertRaw,
+	"youtube":    convertYouTube,
+	"vimeo":      convertVimeo,
+	"gist":       convertGist,
+	"post_link":  convertPostLink,
+	"post_path":  convertPostPath,
+}
+
+// convertHexoTags rewrites the Hexo tag plugins in a Markdown body as Hugo shortcodes or plain
+// Markdown. Tags inside fenced code blocks are left alone, as Hexo does not render them.
+// Tags that cannot be converted are kept verbatim and reported. startLine is the file line
+// on which body begins.
+func convertHexoTags(body string, startLine int) (string, []Warning) {
+	matches := hexoTagPattern.FindAllStringSubmatchIndex(body, -1)
+	if len(matches) == 0 {
+		return body, nil
+	}
+
+	fences := codeFenceRanges(body)
+	var (
+		out      strings.Builder
+		warnings []Warning
+		last     int
+		kept     = make(map[int]bool) // End tags of blocks kept verbatim, whose content is still converted
+	)
+	for i := 0; i < len(matches); i++ {
+		m := matches[i]
+		if m[0] < last || inRanges(fences, m[0]) || kept[i] {
+			continue
+		}
+
+		tag := hexoTag{
+			name: body[m[2]:m[3]],
+			args: splitTagArgs(body[m[4]:m[5]]),
+			line: startLine + strings.Count(body[:m[0]], "\n"),
+		}
+		end := m[1]
+
+		if strings.HasPrefix(tag.name, "end") {
+			warnings = append(warnings, Warning{Line: tag.line, Message: fmt.Sprintf("unmatched Hexo tag {%% %s %%}", tag.name)})
+			continue
+		}
+		closing := closingTag(body, matches, i, fences)
+		if closing < 0 && hexoBlockTags[tag.name] {
+			warnings = append(warnings, Warning{Line: tag.line, Message: fmt.Sprintf("Hexo tag {%% %s %%} has no {%% end%s %%}", tag.name, tag.name)})
+			continue
+		}
+		if closing >= 0 {
+			tag.content = body[m[1]:matches[closing][0]]
+			end = matches[closing][1]
+		}
+
+		convert, ok := hexoTagConverters[tag.name]
+		if !ok {
+			warnings = append(warnings, Warning{Line: tag.line, Message: fmt.Sprintf("unsupported Hexo tag {%% %s %%}", tag.name)})
+			kept[closing] = true
+			continue
+		}
+		converted, ok := convert(tag)
+		if !ok {
+			warnings = append(warnings, Warning{Line: tag.line, Message: fmt.Sprintf("cannot convert Hexo tag {%% %s %%}", strings.TrimSpace(body[m[2]:m[5]]))})
+			kept[closing] = true
+			continue
+		}
+
+		out.WriteString(body[last:m[0]])
+		out.WriteString(converted)
+		last = end
+		if closing >= 0 {
+			i = closing
+		}
+	}
+	out.WriteString(body[last:])
+	return out.String(), warnings
+}
+
+// closingTag returns the index of the match that closes the block tag at matches[open], honoring
+// nested tags of the same name, or -1 if the block is not closed
+func closingTag(body string, matches [][]int, open int, fences [][2]int) int {
+	name := body[matches[open][2]:matches[open][3]]
+	depth := 0
+	for i := open + 1; i < len(matches); i++ {
+		if inRanges(fences, matches[i][0]) {
+			continue
+		}
+		switch body[matches[i][2]:matches[i][3]] {
+		case name:
+			depth++
+		case "end" + name:
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// codeFenceRanges returns the byte ranges of the fenced code blocks in a Markdown body
+func codeFenceRanges(body string) [][2]int {
+	var (
+		ranges [][2]int
+		fence  string
+		start  int
+	)
+	for offset := 0; offset < len(body); {
+		line, _ := cutLine(body[offset:])
+		trimmed := strings.TrimLeft(line, " ")
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+			start = offset
+		case fence != "" && strings.HasPrefix(trimLine(trimmed), fence) && strings.Trim(trimLine(trimmed), fence[:1]) == "":
+			ranges = append(ranges, [2]int{start, offset + len(line)})
+			fence = ""
+		}
+		offset += len(line) + 1
+	}
+	if fence != "" {
+		ranges = append(ranges, [2]int{start, len(body)})
+	}
+	return ranges
+}
+
+// inRanges reports whether offset lies within one of ranges
+func inRanges(ranges [][2]int, offset int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTagArgs splits tag arguments on whitespace, keeping quoted arguments together
+func splitTagArgs(s string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		quote   rune
+		inArg   bool
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// trimEscapeArg drops the trailing escape flag accepted by Hexo's link tags
+func trimEscapeArg(args []string) []string {
+	if n := len(args); n > 1 && (args[n-1] == "true" || args[n-1] == "false") {
+		return args[:n-1]
+	}
+	return args
+}
+
+// trimBlockContent drops the line breaks that surround the content of a block tag
+func trimBlockContent(content string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(content, "\n"), "\n")
+}
+
+// quoteLines prefixes each line of text with "> "
+func quoteLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isURL reports whether s is an absolute http(s) URL
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// convertAssetImg converts {% asset_img [class] slug [width] [height] [title] %} to a Markdown image
+func convertAssetImg(tag hexoTag) (string, bool) {
+	var slug string
+	var title []string
+	for _, arg := range tag.args {
+		switch {
+		case slug == "" && strings.Contains(arg, "."):
+			slug = arg
+		case slug != "" && len(title) == 0 && isDimension(arg):
+		case slug != "":
+			title = append(title, arg)
+		}
+	}
+	if slug == "" {
+		return "", false
+	}
+	return fmt.Sprintf("![%s](%s)", strings.Join(title, " "), slug), true
+}
+
+// isDimension reports whether an image argument is a width or height such as 300 or 50%
+func isDimension(arg string) bool {
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(arg, "px"), "%")
+	return trimmed != "" && strings.Trim(trimmed, "0123456789") == ""
+}
+
+// convertAssetLink converts {% asset_link slug [title] %} to a Markdown link
+func convertAssetLink(tag hexoTag) (string, bool) {
+	args := trimEscapeArg(tag.args)
+	if len(args) == 0 {
+		return "", false
+	}
+	title := args[0]
+	if len(args) > 1 {
+		title = strings.Join(args[1:], " ")
+	}
+	return fmt.Sprintf("[%s](%s)", title, args[0]), true
+}
+
+// convertAssetPath converts {% asset_path slug %} to the asset's relative path
+func convertAssetPath(tag hexoTag) (string, bool) {
+	if len(tag.args) == 0 {
+		return "", false
+	}
+	return tag.args[0], true
+}
+
+// convertCodeBlock converts {% codeblock [title] [lang:language] [url] [link text] %} to a fenced
+// code block, with the title and link as a caption above it
+func convertCodeBlock(tag hexoTag) (string, bool) {
+	var lang, url string
+	var title, linkText []string
+	for _, arg := range tag.args {
+		switch {
+		case strings.HasPrefix(arg, "lang:"):
+			lang = strings.TrimPrefix(arg, "lang:")
+		case strings.Contains(arg, ":") && !isURL(arg):
+			// Rendering options such as line_number:false have no Markdown equivalent
+		case url == "" && isURL(arg):
+			url = arg
+		case url != "":
+			linkText = append(linkText, arg)
+		default:
+			title = append(title, arg)
+		}
+	}
+
+	var caption []string
+	if len(title) > 0 {
+		caption = append(caption, strings.Join(title, " "))
+	}
+	if url != "" {
+		text := url
+		if len(linkText) > 0 {
+			text = strings.Join(linkText, " ")
+		}
+		caption = append(caption, fmt.Sprintf("[%s](%s)", text, url))
+	}
+
+	var sb strings.Builder
+	if len(caption) > 0 {
+		fmt.Fprintf(&sb, "*%s*\n\n", strings.Join(caption, " "))
+	}
+	fmt.Fprintf(&sb, "```%s\n%s\n```", lang, trimBlockContent(tag.content))
+	return sb.String(), true
+}
+
+// convertBlockquote converts {% blockquote [author[, source]] [link] [source_link_title] %} to a
+// Markdown blockquote, with the attribution on its last line
+func convertBlockquote(tag hexoTag) (string, bool) {
+	var by, linkText []string
+	var link string
+	for _, arg := range tag.args {
+		switch {
+		case link == "" && isURL(arg):
+			link = arg
+		case link != "":
+			linkText = append(linkText, arg)
+		default:
+			by = append(by, arg)
+		}
+	}
+
+	var attribution []string
+	if len(by) > 0 {
+		attribution = append(attribution, strings.Join(by, " "))
+	}
+	if link != "" {
+		text := link
+		if len(linkText) > 0 {
+			text = strings.Join(linkText, " ")
+		}
+		attribution = append(attribution, fmt.Sprintf("[%s](%s)", text, link))
+	}
+
+	quote := quoteLines(strings.TrimSpace(tag.content))
+	if len(attribution) > 0 {
+		quote += "\n>\n> — " + strings.Join(attribution, ", ")
+	}
+	return quote, true
+}
+
+// convertPullquote converts {% pullquote [class] %} to a Markdown blockquote
+func convertPullquote(tag hexoTag) (string, bool) {
+	return quoteLines(strings.TrimSpace(tag.content)), true
+}
+
+// convertRaw unwraps the content of {% raw %}, which Hugo leaves alone anyway
+func convertRaw(tag hexoTag) (string, bool) {
+	return trimBlockContent(tag.content), true
+}
+
+// convertYouTube converts {% youtube video_id %} to Hugo's youtube shortcode. Playlists have no equivalent.
+func convertYouTube(tag hexoTag) (string, bool) {
+	if len(tag.args) == 0 || (len(tag.args) > 1 && tag.args[1] == "playlist") {
+		return "", false
+	}
+	return fmt.Sprintf("{{< youtube %s >}}", tag.args[0]), true
+}
+
+// convertVimeo converts {% vimeo video_id %} to Hugo's vimeo shortcode
+func convertVimeo(tag hexoTag) (string, bool) {
+	if len(tag.args) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("{{< vimeo %s >}}", tag.args[0]), true
+}
+
+// convertGist converts {% gist user/gist_id [filename] %} to Hugo's gist shortcode.
+// Hugo needs the gist's owner, so a bare gist ID cannot be converted.
+func convertGist(tag hexoTag) (string, bool) {
+	if len(tag.args) == 0 {
+		return "", false
+	}
+	user, id, ok := strings.Cut(tag.args[0], "/")
+	if !ok || user == "" || id == "" {
+		return "", false
+	}
+	args := append([]string{user, id}, tag.args[1:]...)
+	return fmt.Sprintf("{{< gist %s >}}", strings.Join(args, " ")), true
+}
+
+// convertPostLink converts {% post_link filename [title] %} to a Markdown link using Hugo's ref shortcode
+func convertPostLink(tag hexoTag) (string, bool) {
+	args := trimEscapeArg(tag.args)
+	if len(args) == 0 {
+		return "", false
+	}
+	title := args[0]
+	if len(args) > 1 {
+		title = strings.Join(args[1:], " ")
+	}
+	return fmt.Sprintf(`[%s]({{< ref "%s" >}})`, title, args[0]), true
+}
+
+// convertPostPath converts {% post_path filename %} to Hugo's ref shortcode
+func convertPostPath(tag hexoTag) (string, bool) {
+	if len(tag.args) == 0 {
+		return "", false
+	}
+	return fmt.Sprintf(`{{< ref "%s" >}}`, tag.args[0]), true
+}
@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Built-in value transforms. A transform is written as its name, optionally followed by a colon
+// and an argument, such as "split:;" or "date:2006-01-02".
+const (
+	TransformNegate      = "negate"       // Negate a number
+	TransformInvert      = "invert"       // Flip a boolean, or negate a number
+	TransformLastSegment = "last-segment" // Keep the last segment of a URL path, without .html
+	TransformDate        = "date"         // Reformat a date: rfc3339 (default), date, datetime or a Go layout
+	TransformSplit       = "split"        // Split a string on a separator (default ",") into a list
+	TransformBool        = "bool"         // Coerce a string or number to a boolean
+	TransformList        = "list"         // Wrap a scalar in a list
+)
+
+// ErrTransformValue is returned when a transform cannot be applied to a value
+var ErrTransformValue = errors.New("cannot transform value")
+
+// errKeepValue marks a transform failure that leaves the value as it was with a warning,
+// rather than failing the file, for transforms of the built-in mappings
+var errKeepValue = errors.New("keeping the value as it is")
+
+// valueTransform computes a new front matter value from an existing one
+type valueTransform func(value *yaml.Node, arg string) (*yaml.Node, error)
+
+// valueTransforms maps transform names to their implementations
+var valueTransforms = map[string]valueTransform{
+	TransformNegate:      negateValue,
+	TransformInvert:      invertValue,
+	TransformLastSegment: lastSegmentValue,
+	TransformDate:        dateValue,
+	TransformSplit:       splitValue,
+	TransformBool:        boolValue,
+	TransformList:        listValue,
+}
+
+// dateLayouts are the layouts tried, in order, when parsing a date string
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+}
+
+// namedDateLayouts are the output layouts that can be referred to by name
+var namedDateLayouts = map[string]string{
+	"":         time.RFC3339,
+	"rfc3339":  time.RFC3339,
+	"date":     "2006-01-02",
+	"datetime": "2006-01-02 15:04:05",
+}
+
+// parsedTransform is a transform spec resolved to its implementation
+type parsedTransform struct {
+	name string
+	arg  string
+	fn   valueTransform
+}
+
+// parseTransform resolves a transform spec such as "split:;"
+func parseTransform(spec string) (parsedTransform, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	fn, ok := valueTransforms[name]
+	if !ok {
+		return parsedTransform{}, fmt.Errorf("unknown transform %q", name)
+	}
+	return parsedTransform{name: name, arg: arg, fn: fn}, nil
+}
+
+// transformNode applies transforms to node in place, keeping its comments. If a transform
+// leaves the value as it was, node is not changed and the reason is returned as a warning.
+func transformNode(node *yaml.Node, transforms []parsedTransform) (string, error) {
+	if len(transforms) == 0 {
+		return "", nil
+	}
+
+	value := cloneNode(resolveAlias(node))
+	value.HeadComment, value.LineComment, value.FootComment = "", "", ""
+	for _, transform := range transforms {
+		next, err := transform.fn(value, transform.arg)
+		if errors.Is(err, errKeepValue) {
+			return fmt.Sprintf("%s: %v", transform.name, err), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", transform.name, err)
+		}
+		value = next
+	}
+
+	value.HeadComment, value.LineComment, value.FootComment = node.HeadComment, node.LineComment, node.FootComment
+	*node = *value
+	return "", nil
+}
+
+// encodeValue builds a node for a Go value
+func encodeValue(v interface{}) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(v); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// numberValue reads a numeric scalar, accepting numeric strings
+func numberValue(node *yaml.Node) (float64, bool, error) {
+	if node.Kind == yaml.ScalarNode {
+		if i, err := strconv.ParseInt(strings.TrimSpace(node.Value), 10, 64); err == nil {
+			return float64(i), true, nil
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(node.Value), 64); err == nil {
+			return f, false, nil
+		}
+	}
+	return 0, false, fmt.Errorf("%w: %q is not a number", ErrTransformValue, node.Value)
+}
+
+// negateValue negates a number, keeping any other value with a warning
+func negateValue(node *yaml.Node, _ string) (*yaml.Node, error) {
+	number, isInt, err := numberValue(node)
+	if err != nil {
+		return nil, fmt.Errorf("%w; %w", err, errKeepValue)
+	}
+	if isInt {
+		return encodeValue(int64(-number))
+	}
+	return encodeValue(-number)
+}
+
+// invertValue flips a boolean or negates a number
+func invertValue(node *yaml.Node, arg string) (*yaml.Node, error) {
+	if _, _, err := numberValue(node); err == nil {
+		return negateValue(node, arg)
+	}
+
+	b, err := parseBool(node)
+	if err != nil {
+		return nil, err
+	}
+	return encodeValue(!b)
+}
+
+// lastSegmentValue keeps the last segment of a URL path, dropping a trailing slash and .html
+// extension; any other value is kept with a warning
+func lastSegmentValue(node *yaml.Node, _ string) (*yaml.Node, error) {
+	if node.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("%w: not a string; %w", ErrTransformValue, errKeepValue)
+	}
+
+	segment := strings.TrimRight(node.Value, "/")
+	segment = segment[strings.LastIndex(segment, "/")+1:]
+	if ext := path.Ext(segment); ext == ".html" || ext == ".htm" {
+		segment = strings.TrimSuffix(segment, ext)
+	}
+	return scalarNode(tagString, segment), nil
+}
+
+// dateValue reformats a date with a named or Go layout
+func dateValue(node *yaml.Node, layout string) (*yaml.Node, error) {
+	t, err := parseDate(node)
+	if err != nil {
+		return nil, err
+	}
+	if named, ok := namedDateLayouts[layout]; ok {
+		layout = named
+	}
+	return dateNode(t.Format(layout)), nil
+}
+
+// parseDate reads a date from a timestamp or string scalar, as UTC if it has no offset
+func parseDate(node *yaml.Node) (time.Time, error) {
+	if node.Kind != yaml.ScalarNode {
+		return time.Time{}, fmt.Errorf("%w: not a date", ErrTransformValue)
+	}
+	t, _, err := parseDateIn(node.Value, time.UTC)
+	return t, err
+}
+
+// dateNode creates a scalar for a formatted date, tagged as a timestamp if YAML reads it as one
+func dateNode(value string) *yaml.Node {
+	var probe yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &probe); err == nil && len(probe.Content) == 1 && probe.Content[0].Tag == tagTimestamp {
+		return scalarNode(tagTimestamp, value)
+	}
+	return scalarNode(tagString, value)
+}
+
+// splitValue splits a string on a separator into a list of trimmed, non-empty items
+func splitValue(node *yaml.Node, separator string) (*yaml.Node, error) {
+	if node.Kind == yaml.SequenceNode {
+		return node, nil
+	}
+	if node.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("%w: not a string", ErrTransformValue)
+	}
+	if separator == "" {
+		separator = ","
+	}
+
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, item := range strings.Split(node.Value, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			list.Content = append(list.Content, scalarNode(tagString, item))
+		}
+	}
+	return list, nil
+}
+
+// boolValue coerces a string or number to a boolean
+func boolValue(node *yaml.Node, _ string) (*yaml.Node, error) {
+	b, err := parseBool(node)
+	if err != nil {
+		return nil, err
+	}
+	return encodeValue(b)
+}
+
+// parseBool reads a boolean from a scalar such as true, yes, on, 1 or their opposites
+func parseBool(node *yaml.Node) (bool, error) {
+	if node.Kind == yaml.ScalarNode {
+		switch strings.ToLower(strings.TrimSpace(node.Value)) {
+		case "true", "yes", "y", "on":
+			return true, nil
+		case "false", "no", "n", "off", "", "~", "null":
+			return false, nil
+		}
+		if number, _, err := numberValue(node); err == nil && !math.IsNaN(number) {
+			return number != 0, nil
+		}
+	}
+	return false, fmt.Errorf("%w: %q is not a boolean", ErrTransformValue, node.Value)
+}
+
+// listValue wraps a scalar or mapping in a list, turning null into an empty list
+func listValue(node *yaml.Node, _ string) (*yaml.Node, error) {
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	switch {
+	case node.Kind == yaml.SequenceNode:
+		return node, nil
+	case node.Tag != tagNull:
+		list.Content = append(list.Content, node)
+	}
+	return list, nil
+}
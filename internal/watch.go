@@ -0,0 +1,360 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default timing of watch mode
+const (
+	DefaultPollInterval = time.Second
+	DefaultDebounce     = 500 * time.Millisecond
+)
+
+// pendingChange is a source file that changed and is waiting to settle
+type pendingChange struct {
+	at   time.Time   // When the latest change was seen
+	prev os.FileInfo // The file as it was before its first pending change, nil if it is new
+}
+
+// watcher mirrors a source directory into a destination directory, one changed file at a time
+type watcher struct {
+	cfg       *Config
+	srcDir    string
+	dstDir    string
+	processor *FileProcessor
+	files     map[string]os.FileInfo   // Watched files by path relative to srcDir, as of the last scan
+	outputs   map[string]string        // Destination each watched file was last written to
+	pending   map[string]pendingChange // Changed files, by path relative to srcDir
+	events    func(file FileReport)    // Called with each file that was converted, placed, removed or failed
+	logger    *slog.Logger
+}
+
+// WatchPosts converts the posts in srcDir into dstDir like ConvertPosts, then polls srcDir every
+// cfg.PollInterval and converts each post that changed once it has been left alone for
+// cfg.Debounce. Deleted and renamed sources are mirrored in dstDir, and assets are placed as
+// cfg.AssetMode says. Each of these events is passed to events, including files that failed,
+// and watching goes on. WatchPosts returns when ctx is cancelled.
+func WatchPosts(ctx context.Context, srcDir, dstDir string, cfg *Config, events func(file FileReport)) error {
+	if cfg == nil {
+		cfg = NewDefaultConfig()
+	}
+	if err := validateAssetOptions(cfg); err != nil {
+		return err
+	}
+	switch {
+	case cfg.InPlace:
+		return errors.New("posts cannot be watched in place")
+	case cfg.DryRun:
+		return errors.New("dry runs cannot watch for changes")
+	case sameDir(srcDir, dstDir):
+		return ErrSameDirectory
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return fmt.Errorf("creating destination directory %s: %w", dstDir, err)
+	}
+	converter, err := NewMarkdownConverter(cfg)
+	if err != nil {
+		return fmt.Errorf("creating markdown converter: %w", err)
+	}
+
+	w := &watcher{
+		cfg:       cfg,
+		srcDir:    srcDir,
+		dstDir:    dstDir,
+		processor: NewFileProcessor(converter, srcDir, dstDir, cfg.FileExtension),
+		outputs:   make(map[string]string),
+		pending:   make(map[string]pendingChange),
+		events:    events,
+		logger:    loggerFor(cfg),
+	}
+	if w.files, err = w.scan(); err != nil {
+		return fmt.Errorf("walking source directory %s: %w", srcDir, err)
+	}
+	w.logger.Info("watching for changes", "src", srcDir, "dst", dstDir, "interval", cfg.PollInterval, "debounce", cfg.Debounce)
+	w.sync(ctx)
+
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			w.poll(ctx, now)
+		}
+	}
+}
+
+// scan returns the watched files under the source directory. Files that disappear while the
+// directory is walked are left out.
+func (w *watcher) scan() (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	err := filepath.WalkDir(w.srcDir, func(path string, d os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path != w.srcDir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(w.srcDir, path)
+		if err != nil {
+			return err
+		}
+		if !w.isPost(path) && !w.isAsset(relPath) {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files[relPath] = info
+		return nil
+	})
+	return files, err
+}
+
+// isPost reports whether the file at path is converted
+func (w *watcher) isPost(path string) bool {
+	return strings.HasSuffix(path, w.cfg.FileExtension)
+}
+
+// isAsset reports whether the file at relPath is placed as an asset
+func (w *watcher) isAsset(relPath string) bool {
+	mode := w.cfg.AssetMode
+	return mode != "" && mode != AssetNone && includeAsset(filepath.ToSlash(relPath), w.cfg)
+}
+
+// target returns the destination of the watched file at relPath
+func (w *watcher) target(relPath string) string {
+	src := filepath.Join(w.srcDir, relPath)
+	dst := filepath.Join(w.dstDir, relPath)
+	if w.isPost(src) {
+		return w.processor.targetPath(src, dst)
+	}
+	return dst
+}
+
+// sync brings the destination up to date when watching starts: posts whose output is missing or
+// older than their source are converted, and assets are placed unless they are unchanged
+func (w *watcher) sync(ctx context.Context) {
+	relPaths := make([]string, 0, len(w.files))
+	for relPath := range w.files {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+
+	for _, relPath := range relPaths {
+		if ctx.Err() != nil {
+			return
+		}
+		dst := w.target(relPath)
+		if w.isPost(relPath) {
+			if info, err := os.Stat(dst); err == nil && !info.ModTime().Before(w.files[relPath].ModTime()) {
+				w.outputs[relPath] = dst
+				continue
+			}
+		}
+		w.update(ctx, relPath, "")
+	}
+}
+
+// poll scans the source directory, records the files that changed since the last scan, and
+// applies the changes that have settled
+func (w *watcher) poll(ctx context.Context, now time.Time) {
+	files, err := w.scan()
+	if err != nil {
+		w.fail(w.logger, FileReport{Source: w.srcDir}, fmt.Errorf("scanning source directory: %w", err))
+		return
+	}
+
+	for relPath, info := range files {
+		if prev, ok := w.files[relPath]; !ok || fileChanged(prev, info) {
+			w.markChanged(relPath, now)
+		}
+	}
+	for relPath := range w.files {
+		if _, ok := files[relPath]; !ok {
+			w.markChanged(relPath, now)
+		}
+	}
+	w.files = files
+
+	// Take the changes that have settled, sorted so renames pair up in a stable order
+	var removed, updated []string
+	for relPath, change := range w.pending {
+		if now.Sub(change.at) < w.cfg.Debounce {
+			continue
+		}
+		if _, ok := files[relPath]; ok {
+			updated = append(updated, relPath)
+		} else {
+			removed = append(removed, relPath)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(updated)
+
+	// A new file that is the same file as a removed one was renamed; its old output goes
+	renamed := make(map[string]string)
+	for _, from := range removed {
+		prev := w.pending[from].prev
+		if prev == nil {
+			continue
+		}
+		for _, to := range updated {
+			if _, taken := renamed[to]; !taken && w.pending[to].prev == nil && os.SameFile(prev, files[to]) {
+				renamed[to] = from
+				break
+			}
+		}
+	}
+
+	for _, relPath := range removed {
+		delete(w.pending, relPath)
+		if ctx.Err() != nil {
+			return
+		}
+		w.remove(relPath, renamed)
+	}
+	for _, relPath := range updated {
+		delete(w.pending, relPath)
+		if ctx.Err() != nil {
+			return
+		}
+		w.update(ctx, relPath, renamed[relPath])
+	}
+}
+
+// markChanged records a change of the file at relPath, keeping the file as it was before its
+// first pending change
+func (w *watcher) markChanged(relPath string, now time.Time) {
+	change, ok := w.pending[relPath]
+	if !ok {
+		change.prev = w.files[relPath]
+	}
+	change.at = now
+	w.pending[relPath] = change
+}
+
+// fileChanged reports whether a file was modified or replaced between two scans
+func fileChanged(prev, cur os.FileInfo) bool {
+	return prev.Size() != cur.Size() || !prev.ModTime().Equal(cur.ModTime()) || !os.SameFile(prev, cur)
+}
+
+// update converts or places the file at relPath, removing its previous output if it moved.
+// renamedFrom is the path the file had before it was renamed, if it was.
+func (w *watcher) update(ctx context.Context, relPath, renamedFrom string) {
+	start := time.Now()
+	src := filepath.Join(w.srcDir, relPath)
+	dst := w.target(relPath)
+	file := FileReport{Source: src, Destination: dst, Status: StatusConverted}
+	if renamedFrom != "" {
+		file.RenamedFrom = filepath.Join(w.srcDir, renamedFrom)
+	}
+	if prev, ok := w.outputs[relPath]; ok && prev != dst {
+		w.removeOutput(prev)
+	}
+
+	ctx, logger := withFileLogger(ctx, w.logger, src)
+	if renamedFrom != "" {
+		logger.Info("renamed source", "from", file.RenamedFrom)
+	}
+
+	var err error
+	if w.isPost(src) {
+		file.FileResult, err = w.processor.ProcessFile(ctx, src)
+	} else {
+		var transferred bool
+		file.Asset = w.cfg.AssetMode
+		if transferred, err = transferAsset(ctx, src, dst, w.cfg.AssetMode, w.cfg.AssetUnchanged); err == nil && !transferred {
+			w.outputs[relPath] = dst
+			return // Already in place
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	file.Duration = time.Since(start)
+	if err != nil {
+		w.fail(logger, file, err)
+		return
+	}
+	w.outputs[relPath] = dst
+	logger.Info("updated output", "path", dst, "duration", file.Duration)
+	w.emit(file)
+}
+
+// remove deletes the output of the file at relPath, whose source is gone. The output of a
+// renamed file is removed silently, as its new name is reported instead.
+func (w *watcher) remove(relPath string, renamed map[string]string) {
+	dst, ok := w.outputs[relPath]
+	if !ok {
+		dst = w.target(relPath)
+	}
+	delete(w.outputs, relPath)
+	file := FileReport{Source: filepath.Join(w.srcDir, relPath), Destination: dst, Status: StatusRemoved}
+	if !w.isPost(relPath) {
+		file.Asset = w.cfg.AssetMode
+	}
+	if err := w.removeOutput(dst); err != nil {
+		w.fail(w.logger.With("file", file.Source), file, err)
+		return
+	}
+	for _, from := range renamed {
+		if from == relPath {
+			return
+		}
+	}
+	w.logger.Info("removed output of deleted source", "file", file.Source, "path", dst)
+	w.emit(file)
+}
+
+// removeOutput deletes a file in the destination, and the directories its removal leaves empty.
+// A file that is already gone is not an error.
+func (w *watcher) removeOutput(dst string) error {
+	if err := os.Remove(dst); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("removing output: %w", err)
+	}
+	for dir := filepath.Dir(dst); dir != w.dstDir && strings.HasPrefix(dir, w.dstDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // Not empty
+		}
+	}
+	return nil
+}
+
+// fail logs and passes on a file that failed with err
+func (w *watcher) fail(logger *slog.Logger, file FileReport, err error) {
+	file.Status, file.Error = StatusFailed, newConversionError(file.Source, err)
+	logger.Error("conversion failed", "code", file.Error.Code(), "error", err)
+	w.emit(file)
+}
+
+// emit passes on a watch event
+func (w *watcher) emit(file FileReport) {
+	if w.events != nil {
+		w.events(file)
+	}
+}
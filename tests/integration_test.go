@@ -1,12 +1,20 @@
 package tests
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/pplmx/h2h/internal"
 	"github.com/stretchr/testify/assert"
@@ -203,7 +211,7 @@ func TestConvertPosts(t *testing.T) {
 			env.Setup()
 
 			// Run the conversion
-			err := internal.ConvertPosts(env.SrcDir, env.DstDir, env.Config)
+			_, err := internal.ConvertPosts(context.Background(), env.SrcDir, env.DstDir, env.Config)
 
 			// Verify results
 			tc.verify(t, env, err)
@@ -243,6 +251,77 @@ func TestEdgeCases(t *testing.T) {
 				env.VerifyFile(t, "nested/nested.md", "This is a nested post.")
 			},
 		},
+		{
+			name: "TOML target format",
+			setupEnv: func(env *TestEnvironment) {
+				env.AddFile(NewTestFile("toml.md", "TOML Post", "2023-05-01", []string{"toml"}, nil))
+			},
+			configMods: func(cfg *internal.Config) {
+				cfg.TargetFormat = internal.FormatTOML
+			},
+			verify: func(t *testing.T, env *TestEnvironment, err error) {
+				assert.NoError(t, err, "ConvertPosts failed for TOML target")
+				content, err := os.ReadFile(filepath.Join(env.DstDir, "toml.md"))
+				require.NoError(t, err)
+				assert.True(t, strings.HasPrefix(string(content), "+++\n"), "TOML front matter should open with +++")
+				assert.Equal(t, 2, strings.Count(string(content), "+++"))
+				assert.NotContains(t, string(content), "---")
+				assert.Contains(t, string(content), `title = "TOML Post"`)
+			},
+		},
+		{
+			name: "TOML target with an integer out of range",
+			setupEnv: func(env *TestEnvironment) {
+				env.AddFile(TestFile{
+					Name:       "big.md",
+					RawContent: true,
+					Content:    "---\ntitle: Big\nbig: 12345678901234567890\n---\n",
+				})
+			},
+			configMods: func(cfg *internal.Config) {
+				cfg.TargetFormat = internal.FormatTOML
+			},
+			verify: func(t *testing.T, env *TestEnvironment, err error) {
+				require.Error(t, err)
+				assert.NoFileExists(t, filepath.Join(env.DstDir, "big.md"))
+			},
+		},
+		{
+			name: "TOML source format",
+			setupEnv: func(env *TestEnvironment) {
+				env.AddFile(TestFile{
+					Name:       "from_toml.md",
+					RawContent: true,
+					Content:    "+++\ntitle = \"From TOML\"\nupdated = \"2023-05-02\"\n+++\n# From TOML\nThis is a test post",
+				})
+			},
+			configMods: func(cfg *internal.Config) {
+				cfg.SourceFormat = internal.FormatTOML
+			},
+			verify: func(t *testing.T, env *TestEnvironment, err error) {
+				assert.NoError(t, err, "ConvertPosts failed for TOML source")
+				env.VerifyFile(t, "from_toml.md", "lastmod: \"2023-05-02\"")
+			},
+		},
+		{
+			name: "Auto-detected source formats",
+			setupEnv: func(env *TestEnvironment) {
+				env.AddFile(NewTestFile("yaml.md", "YAML Post", "2023-05-01", nil, nil))
+				env.AddFile(TestFile{
+					Name:       "toml.md",
+					RawContent: true,
+					Content:    "+++\ntitle = \"TOML Post\"\n+++\nThis is a test post",
+				})
+			},
+			configMods: func(cfg *internal.Config) {
+				cfg.SourceFormat = internal.FormatAuto
+			},
+			verify: func(t *testing.T, env *TestEnvironment, err error) {
+				assert.NoError(t, err, "ConvertPosts failed with auto-detected source formats")
+				env.VerifyFile(t, "yaml.md", "title: YAML Post")
+				env.VerifyFile(t, "toml.md", "title: TOML Post")
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -255,12 +334,479 @@ func TestEdgeCases(t *testing.T) {
 			}
 
 			env.Setup()
-			err := internal.ConvertPosts(env.SrcDir, env.DstDir, env.Config)
+			_, err := internal.ConvertPosts(context.Background(), env.SrcDir, env.DstDir, env.Config)
 			tc.verify(t, env, err)
 		})
 	}
 }
 
+// TestFrontMatterScanning tests how front matter blocks are located in a Markdown file
+func TestFrontMatterScanning(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  []string
+		errLine   int
+		expectErr error
+	}{
+		{
+			name:     "Horizontal rule in body",
+			input:    "---\ntitle: Rules\n---\nabove\n\n---\n\nbelow\n",
+			expected: []string{"title: Rules", "above\n\n---\n\nbelow"},
+		},
+		{
+			name:     "Delimiter inside YAML string",
+			input:    "---\ntitle: \"a --- b\"\n---\nbody\n",
+			expected: []string{`title: "a --- b"`, "body"},
+		},
+		{
+			name:     "CRLF line endings",
+			input:    "---\r\ntitle: Windows\r\n---\r\nbody\r\n",
+			expected: []string{"---\r\ntitle: Windows\r\n---\r\nbody\r\n"},
+		},
+		{
+			name:     "UTF-8 BOM and trailing whitespace on delimiters",
+			input:    "\ufeff---  \ntitle: BOM\n--- \t\nbody\n",
+			expected: []string{"title: BOM", "body"},
+		},
+		{
+			name:     "Empty front matter block",
+			input:    "---\n---\nbody\n",
+			expected: []string{"---\n---\nbody"},
+		},
+		{
+			name:      "No front matter",
+			input:     "# Title\n\n---\n\ntext\n---\n",
+			expectErr: internal.ErrInvalidMarkdown,
+		},
+		{
+			name:    "Unterminated block",
+			input:   "---\ntitle: Open\nbody\n",
+			errLine: 1,
+		},
+		{
+			name:    "Malformed YAML",
+			input:   "---\ntitle: ok\nfoo: bar: baz\n---\nbody\n",
+			errLine: 3,
+		},
+	}
+
+	converter, err := internal.NewMarkdownConverter(internal.NewDefaultConfig())
+	require.NoError(t, err)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			_, err := converter.ConvertMarkdown(strings.NewReader(tc.input), &out)
+
+			switch {
+			case tc.expectErr != nil:
+				assert.ErrorIs(t, err, tc.expectErr)
+			case tc.errLine > 0:
+				var parseErr *internal.ParseError
+				require.ErrorAs(t, err, &parseErr)
+				assert.Equal(t, tc.errLine, parseErr.Line)
+			default:
+				require.NoError(t, err)
+				for _, substr := range tc.expected {
+					assert.Contains(t, out.String(), substr)
+				}
+			}
+		})
+	}
+}
+
+// TestJSONFrontMatter tests reading and writing bare and fenced JSON front matter
+func TestJSONFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		config   func(*internal.Config)
+		expected string
+	}{
+		{
+			name:  "Bare JSON to YAML",
+			input: "{\n  \"title\": \"Bare\",\n  \"sticky\": 2\n}\nbody\n",
+			config: func(cfg *internal.Config) {
+				cfg.SourceFormat = internal.FormatJSON
+			},
+			expected: "---\ntitle: Bare\nweight: -2\n---\nbody\n",
+		},
+		{
+			name:  "Fenced JSON to YAML",
+			input: ";;;\n\"title\": \"Fenced\"\n;;;\nbody\n",
+			config: func(cfg *internal.Config) {
+				cfg.SourceFormat = internal.FormatAuto
+			},
+			expected: "---\ntitle: Fenced\n---\nbody\n",
+		},
+		{
+			name:  "YAML to bare JSON",
+			input: "---\ntags: [a]\ndate: \"2023-05-01\"\ntitle: <Bare>\n---\nbody\n",
+			config: func(cfg *internal.Config) {
+				cfg.TargetFormat = internal.FormatJSON
+				cfg.JSONIndent = 2
+			},
+			expected: "{\n  \"title\": \"<Bare>\",\n  \"date\": \"2023-05-01\",\n  \"tags\": [\n    \"a\"\n  ]\n}\nbody\n",
+		},
+		{
+			name:  "YAML to fenced compact JSON",
+			input: "---\ntitle: Fenced\nsticky: 1\n---\nbody\n",
+			config: func(cfg *internal.Config) {
+				cfg.TargetFormat = internal.FormatJSON
+				cfg.JSONIndent = 0
+				cfg.JSONFenced = true
+				cfg.KeyOrder = []string{"weight"}
+			},
+			expected: ";;;\n\"weight\":-1,\"title\":\"Fenced\"\n;;;\nbody\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := internal.NewDefaultConfig()
+			tc.config(cfg)
+			converter, err := internal.NewMarkdownConverter(cfg)
+			require.NoError(t, err)
+
+			var out strings.Builder
+			_, err = converter.ConvertMarkdown(strings.NewReader(tc.input), &out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+// TestKeyOrderAndComments tests that conversion keeps key order, renamed key positions and comments
+func TestKeyOrderAndComments(t *testing.T) {
+	const source = "---\n" +
+		"# Series info\n" +
+		"tags: [go, hugo]\n" +
+		"title: Ordered # the title\n" +
+		"sticky: 3\n" +
+		"cover:\n" +
+		"    image: a.png\n" +
+		"date: 2021-03-04\n" +
+		"---\n" +
+		"body\n"
+
+	tests := []struct {
+		name     string
+		input    string
+		config   func(*internal.Config)
+		expected string
+	}{
+		{
+			name:   "YAML to YAML",
+			input:  source,
+			config: func(cfg *internal.Config) {},
+			expected: "---\n" +
+				"# Series info\n" +
+				"tags: [go, hugo]\n" +
+				"title: Ordered # the title\n" +
+				"weight: -3\n" +
+				"cover:\n" +
+				"    image: a.png\n" +
+				"date: 2021-03-04\n" +
+				"---\n" +
+				"body\n",
+		},
+		{
+			name:  "YAML to TOML",
+			input: source,
+			config: func(cfg *internal.Config) {
+				cfg.TargetFormat = internal.FormatTOML
+			},
+			expected: "+++\n" +
+				"title = \"Ordered\" # the title\n" +
+				"date = 2021-03-04\n" +
+				"# Series info\n" +
+				"tags = [\"go\", \"hugo\"]\n" +
+				"weight = -3\n" +
+				"\n" +
+				"[cover]\n" +
+				"image = \"a.png\"\n" +
+				"+++\n" +
+				"body\n",
+		},
+		{
+			name:  "TOML to YAML",
+			input: "+++\nzeta = 1\nalpha = 2\nupdated = 2021-03-04T10:20:30+08:00\n\n[params]\ntoc = true\n+++\nbody\n",
+			config: func(cfg *internal.Config) {
+				cfg.SourceFormat = internal.FormatTOML
+			},
+			expected: "---\n" +
+				"zeta: 1\n" +
+				"alpha: 2\n" +
+				"lastmod: 2021-03-04T10:20:30+08:00\n" +
+				"params:\n" +
+				"    toc: true\n" +
+				"---\n" +
+				"body\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := internal.NewDefaultConfig()
+			tc.config(cfg)
+			converter, err := internal.NewMarkdownConverter(cfg)
+			require.NoError(t, err)
+
+			var out strings.Builder
+			_, err = converter.ConvertMarkdown(strings.NewReader(tc.input), &out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+// TestMappingFile tests loading user-defined key mapping rules
+func TestMappingFile(t *testing.T) {
+	const input = "---\ntitle: Mapped\ncover: a.png\nexcerpt: Short\nlayout: post\nsticky: 1\n---\nbody\n"
+
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected string
+		errIs    error
+	}{
+		{
+			name: "YAML rules merged with defaults",
+			file: "mapping.yaml",
+			content: "rules:\n" +
+				"  - from: cover\n    to: images\n" +
+				"  - from: excerpt\n    to: [summary, description]\n" +
+				"  - from: layout\n    delete: true\n",
+			expected: "---\ntitle: Mapped\nimages: a.png\nsummary: Short\ndescription: Short\nweight: -1\n---\nbody\n",
+		},
+		{
+			name: "TOML rules replacing defaults",
+			file: "mapping.toml",
+			content: "replace = true\n\n" +
+				"[[rules]]\nfrom = \"title\"\nto = [\"title\", \"linkTitle\"]\n\n" +
+				"[[rules]]\nfrom = \"layout\"\ndelete = true\n",
+			expected: "---\ntitle: Mapped\nlinkTitle: Mapped\ncover: a.png\nexcerpt: Short\nsticky: 1\n---\nbody\n",
+		},
+		{
+			name:    "Rule without action",
+			file:    "mapping.yaml",
+			content: "rules:\n  - from: cover\n",
+			errIs:   internal.ErrInvalidMappingRule,
+		},
+		{
+			name:    "Unsupported extension",
+			file:    "mapping.ini",
+			content: "",
+			errIs:   internal.ErrUnsupportedFormat,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0644))
+
+			mappings, err := internal.LoadMappingFile(path)
+			if tc.errIs != nil {
+				assert.ErrorIs(t, err, tc.errIs)
+				return
+			}
+			require.NoError(t, err)
+
+			cfg := internal.NewDefaultConfig()
+			cfg.KeyMappings = mappings.Rules
+			cfg.ReplaceKeyMappings = mappings.Replace
+			converter, err := internal.NewMarkdownConverter(cfg)
+			require.NoError(t, err)
+
+			var out strings.Builder
+			_, err = converter.ConvertMarkdown(strings.NewReader(input), &out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+// TestNestedKeyPaths tests mapping rules that read and write dotted key paths
+func TestNestedKeyPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		rules    []internal.MappingRule
+		expected string
+	}{
+		{
+			name:  "Flat key into nested map",
+			input: "---\ntitle: Nested\ncover: a.png\nbanner_img: b.png\n---\n",
+			rules: []internal.MappingRule{
+				{From: "cover", To: internal.StringList{"cover.image"}},
+				{From: "banner_img", To: internal.StringList{"cover.alt"}},
+			},
+			expected: "---\ntitle: Nested\ncover:\n    alt: b.png\n    image: a.png\n---\n",
+		},
+		{
+			name:  "Nested key to top level collapses empty map",
+			input: "---\ntitle: Flat\nparams:\n    toc: true\n---\n",
+			rules: []internal.MappingRule{
+				{From: "params.toc", To: internal.StringList{"toc"}},
+			},
+			expected: "---\ntitle: Flat\ntoc: true\n---\n",
+		},
+		{
+			name:  "Rename within a nested map keeps position",
+			input: "---\nparams:\n    toc: true\n    math: false\n---\n",
+			rules: []internal.MappingRule{
+				{From: "params.toc", To: internal.StringList{"params.showToc"}},
+			},
+			expected: "---\nparams:\n    showToc: true\n    math: false\n---\n",
+		},
+		{
+			name:  "Array index paths",
+			input: "---\nimages:\n    - a.png\n    - b.png\n---\n",
+			rules: []internal.MappingRule{
+				{From: "images[0]", To: internal.StringList{"cover.image", "thumbnails[0]"}},
+			},
+			expected: "---\nimages:\n    - b.png\ncover:\n    image: a.png\nthumbnails:\n    - a.png\n---\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := internal.NewDefaultConfig()
+			cfg.KeyMappings = tc.rules
+			cfg.ReplaceKeyMappings = true
+			converter, err := internal.NewMarkdownConverter(cfg)
+			require.NoError(t, err)
+
+			var out strings.Builder
+			_, err = converter.ConvertMarkdown(strings.NewReader(tc.input), &out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+
+	// An index past the end of a list is rejected rather than padded
+	cfg := internal.NewDefaultConfig()
+	cfg.KeyMappings = []internal.MappingRule{{From: "cover", To: internal.StringList{"images[1000000000]"}}}
+	cfg.ReplaceKeyMappings = true
+	converter, err := internal.NewMarkdownConverter(cfg)
+	require.NoError(t, err)
+	_, err = converter.ConvertMarkdown(strings.NewReader("---\ncover: a.png\nimages:\n    - b.png\n---\n"), io.Discard)
+	assert.ErrorContains(t, err, "writing images[1000000000]: index 1000000000 is past the end of the list")
+}
+
+// TestValueTransforms tests the value transforms applied by mapping rules
+func TestValueTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		rules     []internal.MappingRule
+		direction internal.Direction
+		expected  string
+		warnings  []internal.Warning
+		errIs     error
+	}{
+		{
+			name:     "Default Hexo to Hugo transforms",
+			input:    "---\ntitle: Defaults\npermalink: /2023/05/hello-world.html\nsticky: 10 # pinned\n---\n",
+			expected: "---\ntitle: Defaults\nslug: hello-world\nweight: -10 # pinned\n---\n",
+		},
+		{
+			name:      "Default Hugo to Hexo transforms",
+			input:     "---\ntitle: Defaults\nweight: -10\n---\n",
+			direction: internal.DirectionHugoToHexo,
+			expected:  "---\ntitle: Defaults\nsticky: 10\n---\n",
+		},
+		{
+			name:     "Values the default transforms cannot take are kept",
+			input:    "---\ntitle: Kept\npermalink: [a, b]\nsticky: true\n---\n",
+			expected: "---\ntitle: Kept\nslug: [a, b]\nweight: true\n---\n",
+			warnings: []internal.Warning{
+				{Line: 1, Message: "transforming permalink: last-segment: cannot transform value: not a string; keeping the value as it is"},
+				{Line: 1, Message: "transforming sticky: negate: cannot transform value: \"true\" is not a number; keeping the value as it is"},
+			},
+		},
+		{
+			name:  "Invert boolean",
+			input: "---\nhidden: true\n---\n",
+			rules: []internal.MappingRule{
+				{From: "hidden", To: internal.StringList{"visible"}, Transform: internal.StringList{internal.TransformInvert}},
+			},
+			expected: "---\nvisible: false\n---\n",
+		},
+		{
+			name:  "Reformat date",
+			input: "---\nupdated: 2023/05/01 10:20:30\n---\n",
+			rules: []internal.MappingRule{
+				{From: "updated", To: internal.StringList{"lastmod"}, Transform: internal.StringList{"date:date"}},
+			},
+			expected: "---\nlastmod: 2023-05-01\n---\n",
+		},
+		{
+			name:  "Split and wrap in lists",
+			input: "---\nkeywords: go, hugo ,hexo\ncategory: Tech\n---\n",
+			rules: []internal.MappingRule{
+				{From: "keywords", To: internal.StringList{"tags"}, Transform: internal.StringList{internal.TransformSplit}},
+				{From: "category", To: internal.StringList{"categories"}, Transform: internal.StringList{internal.TransformList}},
+			},
+			expected: "---\ntags:\n    - go\n    - hugo\n    - hexo\ncategories:\n    - Tech\n---\n",
+		},
+		{
+			name:  "Coerce to boolean",
+			input: "---\ncomments: \"yes\"\ntoc: 0\n---\n",
+			rules: []internal.MappingRule{
+				{From: "comments", To: internal.StringList{"comments"}, Transform: internal.StringList{internal.TransformBool}},
+				{From: "toc", To: internal.StringList{"toc"}, Transform: internal.StringList{internal.TransformBool}},
+			},
+			expected: "---\ncomments: true\ntoc: false\n---\n",
+		},
+		{
+			name:  "Value that cannot be transformed",
+			input: "---\nhidden: maybe\n---\n",
+			rules: []internal.MappingRule{
+				{From: "hidden", To: internal.StringList{"draft"}, Transform: internal.StringList{internal.TransformBool}},
+			},
+			errIs: internal.ErrTransformValue,
+		},
+		{
+			name:  "Unknown transform",
+			input: "---\nsticky: 1\n---\n",
+			rules: []internal.MappingRule{
+				{From: "sticky", To: internal.StringList{"weight"}, Transform: internal.StringList{"reverse"}},
+			},
+			errIs: internal.ErrInvalidMappingRule,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := internal.NewDefaultConfig()
+			if tc.direction != "" {
+				cfg.ConversionDirection = tc.direction
+			}
+			if tc.rules != nil {
+				cfg.KeyMappings = tc.rules
+				cfg.ReplaceKeyMappings = true
+			}
+			converter, err := internal.NewMarkdownConverter(cfg)
+			if err == nil {
+				var out strings.Builder
+				var result internal.FileResult
+				result, err = converter.ConvertMarkdown(strings.NewReader(tc.input), &out)
+				if tc.errIs == nil {
+					require.NoError(t, err)
+					assert.Equal(t, tc.expected, out.String())
+					assert.Equal(t, tc.warnings, result.Warnings)
+					return
+				}
+			}
+			assert.ErrorIs(t, err, tc.errIs)
+		})
+	}
+}
+
 // TestConcurrency tests different concurrency levels
 func TestConcurrency(t *testing.T) {
 	const fileCount = 10
@@ -284,7 +830,7 @@ func TestConcurrency(t *testing.T) {
 			}
 			env.Setup()
 
-			err := internal.ConvertPosts(env.SrcDir, env.DstDir, env.Config)
+			_, err := internal.ConvertPosts(context.Background(), env.SrcDir, env.DstDir, env.Config)
 			assert.NoError(t, err, "ConvertPosts failed with concurrency %d", concurrency)
 
 			for i := 0; i < fileCount; i++ {
@@ -321,7 +867,7 @@ func TestParallelConversions(t *testing.T) {
 			}
 			env.Setup()
 
-			err := internal.ConvertPosts(env.SrcDir, env.DstDir, env.Config)
+			_, err := internal.ConvertPosts(context.Background(), env.SrcDir, env.DstDir, env.Config)
 			assert.NoError(t, err, "ConvertPosts failed for parallel environment %d", envNum)
 
 			// Verify in same goroutine to avoid race conditions
@@ -336,6 +882,1307 @@ func TestParallelConversions(t *testing.T) {
 	wg.Wait()
 }
 
+// TestTimezoneNormalization tests that dates are given an explicit offset for Hugo and local time for Hexo
+func TestTimezoneNormalization(t *testing.T) {
+	shanghai, err := internal.LoadTimezone("Asia/Shanghai")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		input     string
+		direction internal.Direction
+		target    internal.Format
+		timezone  *time.Location
+		expected  string
+	}{
+		{
+			name:     "Hexo local times to RFC 3339",
+			timezone: shanghai,
+			input:    "---\ntitle: Zoned\ndate: 2021-03-04 10:20:30\nupdated: \"2021-03-05 08:00:00\" # edited\n---\n",
+			expected: "---\ntitle: Zoned\ndate: 2021-03-04T10:20:30+08:00\nlastmod: 2021-03-05T08:00:00+08:00 # edited\n---\n",
+		},
+		{
+			name:     "Per-file time zone override",
+			timezone: shanghai,
+			input:    "---\ndate: 2021-03-04 10:20:30\ntimezone: \"-05:00\"\n---\n",
+			expected: "---\ndate: 2021-03-04T10:20:30-05:00\n---\n",
+		},
+		{
+			name:     "Dates are kept without a time zone",
+			input:    "---\ndate: 2021-03-04 10:20:30\n---\n",
+			expected: "---\ndate: 2021-03-04 10:20:30\n---\n",
+		},
+		{
+			name:     "Per-file time zone without --timezone",
+			input:    "---\ndate: 2021-03-04 10:20:30\ntimezone: Asia/Shanghai\n---\n",
+			expected: "---\ndate: 2021-03-04T10:20:30+08:00\n---\n",
+		},
+		{
+			name:     "Dates without a time and offsets are kept",
+			timezone: shanghai,
+			input:    "---\ndate: 2021-03-04\npublishDate: 2021-03-04T10:20:30Z\n---\n",
+			expected: "---\ndate: 2021-03-04\npublishDate: 2021-03-04T10:20:30Z\n---\n",
+		},
+		{
+			name:     "Hexo local times to TOML",
+			input:    "---\ndate: 2021-03-04 10:20:30\n---\n",
+			target:   internal.FormatTOML,
+			timezone: shanghai,
+			expected: "+++\ndate = 2021-03-04T10:20:30+08:00\n+++\n",
+		},
+		{
+			name:      "Hugo dates to Hexo local times",
+			input:     "---\ndate: 2021-03-04T02:20:30Z\nlastmod: 2021-03-05T08:00:00+08:00\nexpiryDate: 2021-03-04\n---\n",
+			direction: internal.DirectionHugoToHexo,
+			timezone:  shanghai,
+			expected:  "---\ndate: 2021-03-04 10:20:30\nupdated: 2021-03-05 08:00:00\nexpiryDate: 2021-03-04\n---\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := internal.NewDefaultConfig()
+			cfg.Timezone = tc.timezone
+			if tc.direction != "" {
+				cfg.ConversionDirection = tc.direction
+			}
+			if tc.target != "" {
+				cfg.TargetFormat = tc.target
+			}
+			converter, err := internal.NewMarkdownConverter(cfg)
+			require.NoError(t, err)
+
+			var out strings.Builder
+			_, err = converter.ConvertMarkdown(strings.NewReader(tc.input), &out)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+
+	_, err = internal.LoadTimezone("Mars/Olympus")
+	assert.ErrorIs(t, err, internal.ErrInvalidTimezone)
+}
+
+// TestHexoTagPlugins tests that Hexo tag plugins in the body are rewritten for Hugo
+func TestHexoTagPlugins(t *testing.T) {
+	const header = "---\ntitle: Tags\n---\n"
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+		warnings []internal.Warning
+	}{
+		{
+			name:     "Inline tags",
+			body:     "{% asset_img diagram.png 600 The diagram %}\n{% youtube dQw4w9WgXcQ %}\n{% gist octocat/1234 hello.go %}\nSee {% post_link hello-world 'Hello World' %}.\n",
+			expected: "![The diagram](diagram.png)\n{{< youtube dQw4w9WgXcQ >}}\n{{< gist octocat 1234 hello.go >}}\nSee [Hello World]({{< ref \"hello-world\" >}}).\n",
+		},
+		{
+			name:     "Code block",
+			body:     "{% codeblock main.go lang:go https://go.dev Go %}\nfunc main() {}\n{% endcodeblock %}\n",
+			expected: "*main.go [Go](https://go.dev)*\n\n```go\nfunc main() {}\n```\n",
+		},
+		{
+			name:     "Blockquote with attribution",
+			body:     "{% blockquote David Levithan, Wide Awake %}\nDo not just live.\nLive well.\n{% endblockquote %}\n",
+			expected: "> Do not just live.\n> Live well.\n>\n> — David Levithan, Wide Awake\n",
+		},
+		{
+			name:     "Tags in fenced code are kept",
+			body:     "```\n{% youtube abc %}\n```\n",
+			expected: "```\n{% youtube abc %}\n```\n",
+		},
+		{
+			name:     "Unsupported tags are kept and reported",
+			body:     "Intro\n{% note info %}\nHi {% youtube abc %}\n{% endnote %}\n{% gist 1234 %}\n",
+			expected: "Intro\n{% note info %}\nHi {{< youtube abc >}}\n{% endnote %}\n{% gist 1234 %}\n",
+			warnings: []internal.Warning{
+				{Line: 5, Message: "unsupported Hexo tag {% note %}"},
+				{Line: 8, Message: "cannot convert Hexo tag {% gist 1234 %}"},
+			},
+		},
+		{
+			name:     "Unclosed block tag",
+			body:     "{% codeblock %}\ncode\n",
+			expected: "{% codeblock %}\ncode\n",
+			warnings: []internal.Warning{
+				{Line: 4, Message: "Hexo tag {% codeblock %} has no {% endcodeblock %}"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			converter, err := internal.NewMarkdownConverter(internal.NewDefaultConfig())
+			require.NoError(t, err)
+
+			var out strings.Builder
+			result, err := converter.ConvertMarkdown(strings.NewReader(header+tc.body), &out)
+			require.NoError(t, err)
+			assert.Equal(t, header+tc.expected, out.String())
+			assert.Equal(t, tc.warnings, result.Warnings)
+		})
+	}
+}
+
+// TestHugoShortcodes tests that Hugo shortcodes in the body are rewritten for Hexo
+func TestHugoShortcodes(t *testing.T) {
+	const header = "---\ntitle: Shortcodes\n---\n"
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+		warnings []internal.Warning
+	}{
+		{
+			name:     "Self-closing shortcodes",
+			body:     "{{< youtube id=\"dQw4w9WgXcQ\" >}}\n{{< gist octocat 1234 \"hello.go\" >}}\nSee [post]({{< ref \"posts/hello-world/index.md#intro\" >}}).\n{{< figure src=\"a.png\" alt=\"A\" title=\"Title\" />}}\n",
+			expected: "{% youtube dQw4w9WgXcQ %}\n{% gist octocat/1234 hello.go %}\nSee [post]({% post_path hello-world %}).\n![A](a.png \"Title\")\n",
+		},
+		{
+			name:     "Figure with caption",
+			body:     "{{< figure src=\"a.png\" caption=\"A > B\" link=\"https://example.com\" >}}\n",
+			expected: "<figure><a href=\"https://example.com\"><img src=\"a.png\" alt=\"\"></a><figcaption><p>A > B</p></figcaption></figure>\n",
+		},
+		{
+			name:     "Paired shortcodes",
+			body:     "{{< highlight go \"linenos=table\" >}}\nfunc main() {}\n{{< /highlight >}}\n{{% notice warning \"Careful\" %}}\nMind the *gap*.\n{{% /notice %}}\n",
+			expected: "{% codeblock lang:go %}\nfunc main() {}\n{% endcodeblock %}\n{% note warning %}\n**Careful**\n\nMind the *gap*.\n{% endnote %}\n",
+		},
+		{
+			name:     "Named parameter without a value",
+			body:     "{{< figure src= >}}\n",
+			expected: "{{< figure src= >}}\n",
+			warnings: []internal.Warning{{Line: 4, Message: "cannot convert Hugo shortcode {{< figure src= >}}"}},
+		},
+		{
+			name:     "Escaped shortcode",
+			body:     "Write {{</* youtube abc */>}} to embed.\n",
+			expected: "Write {% raw %}{{< youtube abc >}}{% endraw %} to embed.\n",
+		},
+		{
+			name:     "Unsupported shortcodes are kept and reported",
+			body:     "{{ .Title }}\n{{< tweet user=\"x\" id=\"1\" >}}\n{{< details >}}\n{{< youtube abc >}}\n{{< /details >}}\n{{< highlight go >}}\n",
+			expected: "{{ .Title }}\n{{< tweet user=\"x\" id=\"1\" >}}\n{{< details >}}\n{% youtube abc %}\n{{< /details >}}\n{{< highlight go >}}\n",
+			warnings: []internal.Warning{
+				{Line: 5, Message: "unsupported Hugo shortcode {{< tweet >}}"},
+				{Line: 6, Message: "unsupported Hugo shortcode {{< details >}}"},
+				{Line: 9, Message: "Hugo shortcode {{< highlight >}} has no {{< /highlight >}}"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := internal.NewDefaultConfig()
+			cfg.ConversionDirection = internal.DirectionHugoToHexo
+			converter, err := internal.NewMarkdownConverter(cfg)
+			require.NoError(t, err)
+
+			var out strings.Builder
+			result, err := converter.ConvertMarkdown(strings.NewReader(header+tc.body), &out)
+			require.NoError(t, err)
+			assert.Equal(t, header+tc.expected, out.String())
+			assert.Equal(t, tc.warnings, result.Warnings)
+		})
+	}
+}
+
+// TestMigrateSite tests migrating a Hexo project layout to a Hugo site layout
+func TestMigrateSite(t *testing.T) {
+	projectDir, siteDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"source/_posts/hello.md":      "---\ntitle: Hello\n---\nHello\n",
+		"source/_posts/hello/a.png":   "png",
+		"source/_drafts/wip.md":       "---\ntitle: WIP\n---\nWIP\n",
+		"source/about/index.md":       "---\ntitle: About\n---\nAbout\n",
+		"source/images/logo.png":      "logo",
+		"source/CNAME":                "example.com",
+		"source/_data/menu.yml":       "menu: []",
+		"source/projects/.gitkeep":    "",
+		"themes/landscape/layout.ejs": "ejs",
+	}
+	for name, content := range files {
+		path := filepath.Join(projectDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	layout := internal.LayoutRules([]internal.PathRule{{From: "source/_data", To: "data"}}, false)
+	_, err := internal.MigrateSite(context.Background(), projectDir, siteDir, layout, internal.NewDefaultConfig())
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"content/posts/hello.md":    "---\ntitle: Hello\n---\nHello\n",
+		"content/posts/hello/a.png": "png",
+		"content/posts/wip.md":      "---\ntitle: WIP\ndraft: true\n---\nWIP\n",
+		"content/about.md":          "---\ntitle: About\n---\nAbout\n",
+		"static/images/logo.png":    "logo",
+		"static/CNAME":              "example.com",
+		"data/menu.yml":             "menu: []",
+	}
+	var migrated []string
+	require.NoError(t, filepath.WalkDir(siteDir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			relPath, _ := filepath.Rel(siteDir, path)
+			migrated = append(migrated, filepath.ToSlash(relPath))
+		}
+		return err
+	}))
+	assert.Len(t, migrated, len(expected))
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(siteDir, filepath.FromSlash(name)))
+		require.NoError(t, err, name)
+		assert.Equal(t, content, string(data), name)
+	}
+
+	// Two sources migrating to the same path are rejected
+	conflictDir := t.TempDir()
+	for _, name := range []string{"source/_posts/a.md", "source/_drafts/a.md"} {
+		path := filepath.Join(conflictDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("---\ntitle: A\n---\n"), 0644))
+	}
+	_, err = internal.MigrateSite(context.Background(), conflictDir, t.TempDir(), internal.DefaultHexoLayout, internal.NewDefaultConfig())
+	assert.ErrorContains(t, err, "both migrate to")
+}
+
+// TestSiteConfig tests translating site configurations between Hexo and Hugo
+func TestSiteConfig(t *testing.T) {
+	const hexoConfig = "title: My Blog\n" +
+		"subtitle: Notes\n" +
+		"language: [zh-CN]\n" +
+		"timezone: Asia/Shanghai\n" +
+		"url: https://example.com\n" +
+		"root: /blog/\n" +
+		"permalink: :year/:month/:title/\n" +
+		"new_post_name: :title.md\n" +
+		"per_page: 10\n" +
+		"tag_dir: t\n" +
+		"category_dir: categories\n"
+
+	t.Run("Hexo to Hugo TOML", func(t *testing.T) {
+		cfg := internal.NewDefaultConfig()
+		cfg.TargetFormat = internal.FormatTOML
+		out, notes, err := internal.ConvertSiteConfig([]byte(hexoConfig), internal.FormatYAML, cfg)
+		require.NoError(t, err)
+		const newPostName = "new_post_name: :title.md (Hugo names a new post after the path given to hugo new content, such as posts/my-post.md; set its front matter in archetypes/default.md)"
+		assert.Equal(t, []string{newPostName}, notes)
+		assert.Equal(t, "# Hexo settings without a Hugo equivalent:\n"+
+			"# "+newPostName+"\n"+
+			"title = \"My Blog\"\n"+
+			"baseURL = \"https://example.com/blog/\"\n"+
+			"timeZone = \"Asia/Shanghai\"\n"+
+			"languageCode = \"zh-CN\"\n\n"+
+			"[params]\nsubtitle = \"Notes\"\n\n"+
+			"[permalinks]\nposts = \"/:year/:month/:slugorfilename/\"\ntags = \"/t/:slug/\"\n\n"+
+			"[pagination]\npagerSize = 10\n\n"+
+			"[taxonomies]\ntag = \"tags\"\ncategory = \"categories\"\n", string(out))
+	})
+
+	t.Run("Notes on translated settings", func(t *testing.T) {
+		cfg := internal.NewDefaultConfig()
+		out, notes, err := internal.ConvertSiteConfig([]byte("title: My Blog\nlanguage: [en, de]\ntheme: next\n"), internal.FormatYAML, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"language: only the first language is used; configure the others under languages",
+			"theme: next",
+		}, notes)
+		assert.Equal(t, "# Hexo settings without a Hugo equivalent:\n"+
+			"# theme: next\n\n"+
+			"title: My Blog\n"+
+			"# language: only the first language is used; configure the others under languages\n"+
+			"languageCode: en\n", string(out))
+	})
+
+	t.Run("Hugo to Hexo", func(t *testing.T) {
+		const hugoConfig = "baseURL = \"https://example.com/blog/\"\n" +
+			"title = \"My Blog\"\n" +
+			"theme = \"ananke\"\n\n" +
+			"[params]\nauthor = \"Jane\"\nmainSections = [\"posts\"]\n\n" +
+			"[permalinks]\nposts = \"/:year/:section/:slug/\"\ntags = \"/t/:slug/\"\n"
+
+		cfg := internal.NewDefaultConfig()
+		cfg.ConversionDirection = internal.DirectionHugoToHexo
+		out, notes, err := internal.ConvertSiteConfig([]byte(hugoConfig), internal.FormatTOML, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"permalinks.posts: /:year/:section/:slug/ (no equivalent for :section)",
+			"theme: ananke",
+			"params.mainSections",
+		}, notes)
+		assert.Contains(t, string(out), "title: My Blog\nauthor: Jane\nurl: https://example.com/blog\nroot: /blog/\ntag_dir: t\n")
+	})
+}
+
+// TestAliases tests that old Hexo URLs are added to aliases and written to a redirect map
+func TestAliases(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	posts := map[string]string{
+		"hello.md":       "---\ntitle: Hello\ndate: 2021-03-04 10:20:30\n---\n",
+		"2020/nested.md": "---\ntitle: Nested\ndate: 2020-01-02\npermalink: custom/path/\n---\n",
+		"dup.md":         "---\ntitle: Dup\ndate: 2021-03-04\npermalink: /2021/03/04/hello/\naliases: /old/\n---\n",
+		"undated.md":     "---\ntitle: Undated\n---\n",
+	}
+	for name, content := range posts {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	cfg := internal.NewDefaultConfig()
+	cfg.Timezone = time.UTC
+	cfg.OldPermalink = ":year/:month/:day/:title/"
+	cfg.RedirectFile = filepath.Join(dstDir, "_redirects")
+	_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	assert.EqualError(t, err, "encountered 1 errors during conversion") // dup.md claims hello.md's old URL
+
+	content, err := os.ReadFile(filepath.Join(dstDir, "hello.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "---\ntitle: Hello\ndate: 2021-03-04T10:20:30Z\naliases:\n    - /2021/03/04/hello/\n---\n", string(content))
+
+	content, err = os.ReadFile(filepath.Join(dstDir, "dup.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "---\ntitle: Dup\ndate: 2021-03-04\nslug: hello\naliases:\n    - /old/\n    - /2021/03/04/hello/\n---\n", string(content))
+
+	content, err = os.ReadFile(filepath.Join(dstDir, "undated.md"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "aliases")
+
+	redirects, err := os.ReadFile(cfg.RedirectFile)
+	require.NoError(t, err)
+	assert.Equal(t, "/2021/03/04/hello/ /posts/hello/ 301\n/custom/path/ /posts/path/ 301\n", string(redirects))
+
+	formats := map[string]string{
+		"redirects.map": "/2021/03/04/hello/ /posts/hello/;\n/custom/path/ /posts/path/;\n",
+		"redirects.csv": "old,new\n/2021/03/04/hello/,/posts/hello/\n/custom/path/,/posts/path/\n",
+	}
+	for file, expected := range formats {
+		cfg.RedirectFile = filepath.Join(t.TempDir(), file)
+		_, _ = internal.ConvertPosts(context.Background(), srcDir, t.TempDir(), cfg)
+		redirects, err := os.ReadFile(cfg.RedirectFile)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(redirects), file)
+	}
+}
+
+// TestAssets tests that files other than posts are copied or linked into the destination
+func TestAssets(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string]string{
+		"hello.md":           "---\ntitle: Hello\n---\n",
+		"hello/cover.png":    "png",
+		"hello/notes.pdf":    "pdf",
+		"hello/layers.psd":   "psd",
+		"drafts/sketch.png":  "sketch",
+		"images/banner.jpeg": "jpeg",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	placed := []string{"hello/cover.png", "hello/notes.pdf", "images/banner.jpeg"}
+	left := []string{"hello/layers.psd", "drafts/sketch.png"}
+
+	for _, mode := range []internal.AssetMode{internal.AssetCopy, internal.AssetHardlink, internal.AssetSymlink} {
+		t.Run(string(mode), func(t *testing.T) {
+			dstDir := t.TempDir()
+			cfg := internal.NewDefaultConfig()
+			cfg.AssetMode = mode
+			cfg.AssetExclude = []string{"*.psd", "drafts"}
+			_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+			require.NoError(t, err)
+
+			for _, name := range placed {
+				content, err := os.ReadFile(filepath.Join(dstDir, filepath.FromSlash(name)))
+				require.NoError(t, err, name)
+				assert.Equal(t, files[name], string(content), name)
+			}
+			for _, name := range left {
+				assert.NoFileExists(t, filepath.Join(dstDir, filepath.FromSlash(name)))
+			}
+
+			info, err := os.Lstat(filepath.Join(dstDir, "hello", "cover.png"))
+			require.NoError(t, err)
+			assert.Equal(t, mode == internal.AssetSymlink, info.Mode()&os.ModeSymlink != 0)
+
+			// A second run leaves the placed assets alone
+			_, err = internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("include", func(t *testing.T) {
+		dstDir := t.TempDir()
+		cfg := internal.NewDefaultConfig()
+		cfg.AssetMode = internal.AssetCopy
+		cfg.AssetInclude = []string{"hello/*.png"}
+		_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dstDir, "hello", "cover.png"))
+		assert.NoFileExists(t, filepath.Join(dstDir, "hello", "notes.pdf"))
+		assert.NoFileExists(t, filepath.Join(dstDir, "drafts", "sketch.png"))
+	})
+
+	t.Run("none", func(t *testing.T) {
+		dstDir := t.TempDir()
+		_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, internal.NewDefaultConfig())
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dstDir, "hello.md"))
+		assert.NoFileExists(t, filepath.Join(dstDir, "hello", "cover.png"))
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		// A stale copy of the same size is only replaced by the checks that look beyond the size
+		for check, replaced := range map[internal.UnchangedCheck]bool{
+			internal.UnchangedSize:  false,
+			internal.UnchangedMtime: true,
+			internal.UnchangedHash:  true,
+		} {
+			dstDir := t.TempDir()
+			stale := filepath.Join(dstDir, "images", "banner.jpeg")
+			require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0755))
+			require.NoError(t, os.WriteFile(stale, []byte("JPEG"), 0644))
+
+			cfg := internal.NewDefaultConfig()
+			cfg.AssetMode = internal.AssetCopy
+			cfg.AssetUnchanged = check
+			_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+			require.NoError(t, err)
+
+			content, err := os.ReadFile(stale)
+			require.NoError(t, err)
+			assert.Equal(t, replaced, string(content) == "jpeg", check)
+		}
+	})
+
+	cfg := internal.NewDefaultConfig()
+	cfg.AssetMode = "move"
+	_, err := internal.ConvertPosts(context.Background(), srcDir, t.TempDir(), cfg)
+	assert.ErrorIs(t, err, internal.ErrInvalidAssetMode)
+}
+
+// TestBundles tests that Hexo post asset folders and Hugo page bundles are restructured into each other
+func TestBundles(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction internal.Direction
+		files     map[string]string
+		expected  map[string]string
+	}{
+		{
+			name:      "asset folder to page bundle",
+			direction: internal.DirectionHexoToHugo,
+			files: map[string]string{
+				"foo.md":    "---\ntitle: Foo\n---\n![A](foo/a.png) ![B](./foo/b.png) ![C](https://example.com/c.png)\n{% asset_img foo/d.png D %}\n{% asset_link e.pdf %}\n\n```\n![A](foo/a.png)\n```\n",
+				"foo/a.png": "a",
+				"bar.md":    "---\ntitle: Bar\n---\n![A](foo/a.png)\n",
+			},
+			expected: map[string]string{
+				"foo/index.md": "---\ntitle: Foo\n---\n![A](a.png) ![B](b.png) ![C](https://example.com/c.png)\n![D](d.png)\n[e.pdf](e.pdf)\n\n```\n![A](foo/a.png)\n```\n",
+				"foo/a.png":    "a",
+				"bar.md":       "---\ntitle: Bar\n---\n![A](foo/a.png)\n",
+			},
+		},
+		{
+			name:      "page bundle to asset folder",
+			direction: internal.DirectionHugoToHexo,
+			files: map[string]string{
+				"foo/index.md": "---\ntitle: Foo\n---\n![A](a.png) ![Two words](./b.png \"Title\") ![](/c.png) [doc](e.pdf)\n{{< figure src=\"d.png\" alt=\"D\" >}}\n",
+				"foo/a.png":    "a",
+				"index.md":     "---\ntitle: Home\n---\n",
+			},
+			expected: map[string]string{
+				"foo.md":    "---\ntitle: Foo\n---\n{% asset_img a.png A %} {% asset_img b.png Title \"Two words\" %} ![](/c.png) [doc](e.pdf)\n{% asset_img d.png D %}\n",
+				"foo/a.png": "a",
+				"index.md":  "---\ntitle: Home\n---\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir, dstDir := t.TempDir(), t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(srcDir, filepath.FromSlash(name))
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+			}
+
+			cfg := internal.NewDefaultConfig()
+			cfg.ConversionDirection = tt.direction
+			cfg.Bundles = true
+			cfg.AssetMode = internal.AssetCopy
+			_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+			require.NoError(t, err)
+
+			for name, expected := range tt.expected {
+				content, err := os.ReadFile(filepath.Join(dstDir, filepath.FromSlash(name)))
+				require.NoError(t, err, name)
+				assert.Equal(t, expected, string(content), name)
+			}
+			for name := range tt.files {
+				if _, ok := tt.expected[name]; !ok {
+					assert.NoFileExists(t, filepath.Join(dstDir, filepath.FromSlash(name)))
+				}
+			}
+		})
+	}
+
+	// A post and the bundle it would become cannot both be converted
+	srcDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "foo"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "foo.md"), []byte("---\ntitle: Foo\n---\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "foo", "index.md"), []byte("---\ntitle: Foo\n---\n"), 0644))
+	cfg := internal.NewDefaultConfig()
+	cfg.Bundles = true
+	_, err := internal.ConvertPosts(context.Background(), srcDir, t.TempDir(), cfg)
+	assert.ErrorContains(t, err, "both convert to")
+}
+
+// TestDryRun tests that a dry run reports the planned changes without writing anything
+func TestDryRun(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "out")
+	src := filepath.Join(srcDir, "hello.md")
+	require.NoError(t, os.WriteFile(src, []byte("---\ntitle: Hello\nupdated: 2021-03-04\nsticky: 1\nlayout: post\n---\nSee {% youtube abc %}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "cover.png"), []byte("png"), 0644))
+
+	cfg := internal.NewDefaultConfig()
+	cfg.KeyMappings = []internal.MappingRule{{From: "layout", Delete: true}}
+	cfg.Draft = true
+	cfg.DryRun = true
+	cfg.Diff = true
+	cfg.AssetMode = internal.AssetCopy
+	cfg.RedirectFile = filepath.Join(dstDir, "_redirects")
+	_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.NoError(t, err)
+	assert.NoDirExists(t, dstDir)
+
+	converter, err := internal.NewMarkdownConverter(cfg)
+	require.NoError(t, err)
+	processor := internal.NewFileProcessor(converter, srcDir, dstDir, cfg.FileExtension)
+	dst := filepath.Join(dstDir, "hello.md")
+	result, err := processor.PlanFile(context.Background(), src, dst, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, []internal.KeyRename{
+		{From: "sticky", To: []string{"weight"}},
+		{From: "updated", To: []string{"lastmod"}},
+	}, result.Renamed)
+	assert.Equal(t, []string{"draft"}, result.Added)
+	assert.Equal(t, []string{"layout"}, result.Removed)
+	assert.Equal(t, "--- "+src+"\n+++ "+dst+"\n"+`@@ -1,7 +1,7 @@
+ ---
+ title: Hello
+-updated: 2021-03-04
+-sticky: 1
+-layout: post
++lastmod: 2021-03-04
++weight: -1
++draft: true
+ ---
+-See {% youtube abc %}
++See {{< youtube abc >}}
+`, result.Diff)
+	assert.NoDirExists(t, dstDir)
+}
+
+// TestInPlace tests that posts are rewritten in place, backed up, and restored from their backups
+func TestInPlace(t *testing.T) {
+	const original = "---\ntitle: Hello\nsticky: 2\n---\nBody\n"
+	const converted = "+++\ntitle = \"Hello\"\nweight = -2\n+++\nBody\n"
+
+	for _, mode := range []internal.BackupMode{internal.BackupBak, internal.BackupArchive} {
+		t.Run(string(mode), func(t *testing.T) {
+			dir := t.TempDir()
+			post := filepath.Join(dir, "posts", "hello.md")
+			require.NoError(t, os.MkdirAll(filepath.Dir(post), 0755))
+			require.NoError(t, os.WriteFile(post, []byte(original), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "cover.png"), []byte("png"), 0644))
+
+			cfg := internal.NewDefaultConfig()
+			cfg.TargetFormat = internal.FormatTOML
+			cfg.InPlace = true
+			cfg.Backup = mode
+			cfg.AssetMode = internal.AssetCopy
+			_, err := internal.ConvertPosts(context.Background(), dir, "", cfg)
+			require.NoError(t, err)
+
+			content, err := os.ReadFile(post)
+			require.NoError(t, err)
+			assert.Equal(t, converted, string(content))
+
+			entries, err := os.ReadDir(filepath.Dir(post))
+			require.NoError(t, err)
+			if mode == internal.BackupBak {
+				assert.Len(t, entries, 2) // The post and its backup, no temporary files
+				assert.FileExists(t, post+internal.BackupSuffix)
+			} else {
+				assert.Len(t, entries, 1)
+				archives, err := filepath.Glob(filepath.Join(dir, internal.BackupDir, "*.tar.gz"))
+				require.NoError(t, err)
+				assert.Len(t, archives, 1)
+			}
+
+			count, err := internal.RestoreBackup(dir, "")
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+			content, err = os.ReadFile(post)
+			require.NoError(t, err)
+			assert.Equal(t, original, string(content))
+			assert.NoFileExists(t, post+internal.BackupSuffix)
+		})
+	}
+
+	// A second run keeps the .bak copies of the first, and restore leaves other .bak files alone
+	dir := t.TempDir()
+	post := filepath.Join(dir, "Hello World.md")
+	require.NoError(t, os.WriteFile(post, []byte(original), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt.bak"), []byte("mine"), 0644))
+	cfg := internal.NewDefaultConfig()
+	cfg.SourceFormat = internal.FormatAuto
+	cfg.TargetFormat = internal.FormatTOML
+	cfg.InPlace = true
+	cfg.Backup = internal.BackupBak
+	for i := 0; i < 2; i++ {
+		_, err := internal.ConvertPosts(context.Background(), dir, "", cfg)
+		require.NoError(t, err)
+	}
+	count, err := internal.RestoreBackup(dir, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	content, err := os.ReadFile(post)
+	require.NoError(t, err)
+	assert.Equal(t, original, string(content))
+	assert.FileExists(t, filepath.Join(dir, "notes.txt.bak"))
+
+	// A .bak file that h2h did not make is never overwritten
+	require.NoError(t, os.WriteFile(post+internal.BackupSuffix, []byte("mine"), 0644))
+	_, err = internal.ConvertPosts(context.Background(), dir, "", cfg)
+	assert.ErrorIs(t, err, internal.ErrBackupExists)
+	content, err = os.ReadFile(post + internal.BackupSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, "mine", string(content))
+
+	// Of two archives written in the same second, the one with the -1 suffix is the latest
+	dir = t.TempDir()
+	post = filepath.Join(dir, "hello.md")
+	cfg.Backup = internal.BackupArchive
+	for i, name := range []string{"20990101-120000-1.tar.gz", "20990101-120000.tar.gz"} {
+		require.NoError(t, os.WriteFile(post, []byte(fmt.Sprintf("---\ntitle: Run %d\n---\n", i)), 0644))
+		report, err := internal.ConvertPosts(context.Background(), dir, "", cfg)
+		require.NoError(t, err)
+		require.NoError(t, os.Rename(report.Backup, filepath.Join(dir, internal.BackupDir, name)))
+	}
+	_, err = internal.RestoreBackup(dir, "")
+	require.NoError(t, err)
+	content, err = os.ReadFile(post)
+	require.NoError(t, err)
+	assert.Equal(t, "---\ntitle: Run 0\n---\n", string(content))
+
+	dir = t.TempDir()
+	_, err = internal.RestoreBackup(dir, "")
+	assert.ErrorIs(t, err, internal.ErrNoBackup)
+	_, err = internal.ConvertPosts(context.Background(), dir, dir, internal.NewDefaultConfig())
+	assert.ErrorIs(t, err, internal.ErrSameDirectory)
+}
+
+// TestPartialOutput tests that failed and cancelled conversions leave no partial files behind
+func TestPartialOutput(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "good.md"), []byte("---\ntitle: Good\n---\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "bad.md"), []byte("---\ntitle: [Bad\n---\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "cover.png"), []byte("png"), 0644))
+
+	// A failed conversion keeps the output of the previous run
+	previous := filepath.Join(dstDir, "bad.md")
+	require.NoError(t, os.WriteFile(previous, []byte("previous"), 0644))
+	cfg := internal.NewDefaultConfig()
+	cfg.AssetMode = internal.AssetCopy
+	_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.Error(t, err)
+	content, err := os.ReadFile(previous)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(content))
+
+	entries, err := os.ReadDir(dstDir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"bad.md", "cover.png", "good.md"}, names)
+
+	// A cancelled run stops without writing anything
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dstDir = t.TempDir()
+	_, err = internal.ConvertPosts(ctx, srcDir, dstDir, cfg)
+	assert.ErrorIs(t, err, context.Canceled)
+	entries, err = os.ReadDir(dstDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// TestIncremental tests that incremental runs skip unchanged posts, protect edited outputs and handle deleted sources
+func TestIncremental(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	write := func(dir, name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(dstDir, name))
+		require.NoError(t, err)
+		return string(content)
+	}
+	stat := func(name string) os.FileInfo {
+		info, err := os.Stat(filepath.Join(dstDir, name))
+		require.NoError(t, err)
+		return info
+	}
+	write(srcDir, "a.md", "---\ntitle: A\n---\n")
+	write(srcDir, "b.md", "---\ntitle: B\n---\n")
+
+	cfg := internal.NewDefaultConfig()
+	cfg.Incremental = true
+	convert := func() {
+		_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+		require.NoError(t, err)
+	}
+	convert()
+	assert.FileExists(t, filepath.Join(dstDir, internal.DefaultManifestFile))
+
+	// Unchanged posts are not written again
+	a, b := stat("a.md"), stat("b.md")
+	write(srcDir, "a.md", "---\ntitle: A2\n---\n")
+	convert()
+	assert.False(t, os.SameFile(a, stat("a.md")))
+	assert.True(t, os.SameFile(b, stat("b.md")))
+	assert.Equal(t, "---\ntitle: A2\n---\n", read("a.md"))
+
+	// Outputs edited by hand are protected unless forced
+	write(dstDir, "b.md", "---\ntitle: Edited\n---\n")
+	write(srcDir, "b.md", "---\ntitle: B2\n---\n")
+	convert()
+	assert.Equal(t, "---\ntitle: Edited\n---\n", read("b.md"))
+	cfg.Force = true
+	convert()
+	cfg.Force = false
+	assert.Equal(t, "---\ntitle: B2\n---\n", read("b.md"))
+
+	// Changing an option converts every post again
+	cfg.TargetFormat = internal.FormatTOML
+	convert()
+	assert.Equal(t, "+++\ntitle = \"A2\"\n+++\n", read("a.md"))
+	assert.Equal(t, "+++\ntitle = \"B2\"\n+++\n", read("b.md"))
+
+	// Outputs of deleted sources are kept unless pruned
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "a.md")))
+	convert()
+	assert.FileExists(t, filepath.Join(dstDir, "a.md"))
+	cfg.Prune = true
+	convert()
+	assert.NoFileExists(t, filepath.Join(dstDir, "a.md"))
+	assert.FileExists(t, filepath.Join(dstDir, "b.md"))
+}
+
+// TestIncrementalRedirects tests that incremental reruns keep the URLs of skipped posts in the
+// redirect map and in the URL collision check
+func TestIncrementalRedirects(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644))
+	}
+	write("a.md", "---\ntitle: A\ndate: 2021-01-01\n---\n")
+	write("b.md", "---\ntitle: B\ndate: 2021-01-02\n---\n")
+	write("c.md", "---\ntitle: C\ndate: 2021-01-03\n---\n")
+
+	cfg := internal.NewDefaultConfig()
+	cfg.Incremental = true
+	cfg.Timezone = time.UTC
+	cfg.OldPermalink = ":year/:month/:day/:title/"
+	cfg.RedirectFile = filepath.Join(dstDir, "_redirects")
+	_, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.NoError(t, err)
+	expected := "/2021/01/01/a/ /posts/a/ 301\n/2021/01/02/b/ /posts/b/ 301\n/2021/01/03/c/ /posts/c/ 301\n"
+	redirects, err := os.ReadFile(cfg.RedirectFile)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(redirects))
+
+	// Only a.md is converted again, but the map still holds every post
+	write("a.md", "---\ntitle: A2\ndate: 2021-01-01\n---\n")
+	report, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Count(internal.StatusConverted, false))
+	assert.Equal(t, 3, report.Redirects)
+	redirects, err = os.ReadFile(cfg.RedirectFile)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(redirects))
+
+	// A reconverted post that takes the old URL of a skipped one collides with it
+	write("a.md", "---\ntitle: A3\ndate: 2021-01-01\npermalink: /2021/01/02/b/\n---\n")
+	report, err = internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.Error(t, err)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, internal.CodeURLCollision, report.Errors[0].Code())
+}
+
+// TestIncrementalCancel tests that a cancelled incremental run still records the posts it converted
+func TestIncrementalCancel(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "c.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte("---\ntitle: "+name+"\n---\n"), 0644))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := internal.NewDefaultConfig()
+	cfg.Incremental = true
+	cfg.MaxConcurrency = 1
+	cfg.OnFile = func(internal.FileReport) { cancel() }
+	report, err := internal.ConvertPosts(ctx, srcDir, dstDir, cfg)
+	require.ErrorIs(t, err, context.Canceled)
+	converted := report.Count(internal.StatusConverted, false)
+	require.Positive(t, converted)
+
+	cfg.OnFile = nil
+	report, err = internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, converted, report.Count(internal.StatusSkipped, false))
+	assert.Equal(t, 3-converted, report.Count(internal.StatusConverted, false))
+	for _, file := range report.Files {
+		assert.Empty(t, file.Warnings, file.Source)
+	}
+}
+
+// TestWatch tests that watch mode mirrors new, changed, renamed and deleted sources
+func TestWatch(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644))
+	}
+	converted := func(name, content string) func() bool {
+		return func() bool {
+			got, err := os.ReadFile(filepath.Join(dstDir, name))
+			return err == nil && string(got) == content
+		}
+	}
+	removed := func(name string) func() bool {
+		return func() bool {
+			_, err := os.Stat(filepath.Join(dstDir, name))
+			return os.IsNotExist(err)
+		}
+	}
+	write("a.md", "---\ntitle: A\nupdated: 2021-03-04\n---\n")
+
+	cfg := internal.NewDefaultConfig()
+	cfg.PollInterval = 10 * time.Millisecond
+	cfg.Debounce = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- internal.WatchPosts(ctx, srcDir, dstDir, cfg, nil) }()
+
+	// Existing posts are converted when watching starts
+	assert.Eventually(t, converted("a.md", "---\ntitle: A\nlastmod: 2021-03-04\n---\n"), time.Second, 5*time.Millisecond)
+
+	// New and changed posts are converted
+	write("b.md", "---\ntitle: B\n---\n")
+	assert.Eventually(t, converted("b.md", "---\ntitle: B\n---\n"), time.Second, 5*time.Millisecond)
+	write("b.md", "---\ntitle: B2\n---\n")
+	assert.Eventually(t, converted("b.md", "---\ntitle: B2\n---\n"), time.Second, 5*time.Millisecond)
+
+	// Renamed posts move, and deleted posts are removed
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.Rename(filepath.Join(srcDir, "a.md"), filepath.Join(srcDir, "sub", "c.md")))
+	assert.Eventually(t, converted("sub/c.md", "---\ntitle: A\nlastmod: 2021-03-04\n---\n"), time.Second, 5*time.Millisecond)
+	assert.Eventually(t, removed("a.md"), time.Second, 5*time.Millisecond)
+	require.NoError(t, os.RemoveAll(filepath.Join(srcDir, "sub")))
+	assert.Eventually(t, removed("sub"), time.Second, 5*time.Millisecond)
+	assert.FileExists(t, filepath.Join(dstDir, "b.md"))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+// TestReport tests the per-file report of a conversion run
+func TestReport(t *testing.T) {
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"a.md":      "---\ntitle: A\nupdated: 2021-03-04\n---\n{% note %}\n",
+		"b.md":      "+++\ntitle = \"B\"\n+++\n",
+		"bad.md":    "---\ntitle: [\n---\n",
+		"image.png": "png",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644))
+	}
+
+	cfg := internal.NewDefaultConfig()
+	cfg.SourceFormat = internal.FormatAuto
+	cfg.AssetMode = internal.AssetCopy
+	report, err := internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	assert.EqualError(t, err, "encountered 1 errors during conversion")
+	require.NotNil(t, report)
+	assert.Equal(t, srcDir, report.SrcDir)
+	require.Len(t, report.Files, 4)
+	require.Len(t, report.Errors, 1)
+
+	a, b, bad, image := report.Files[0], report.Files[1], report.Files[2], report.Files[3]
+	assert.Equal(t, filepath.Join(srcDir, "a.md"), a.Source)
+	assert.Equal(t, filepath.Join(dstDir, "a.md"), a.Destination)
+	assert.Equal(t, internal.StatusConverted, a.Status)
+	assert.Equal(t, internal.FormatYAML, a.Format)
+	assert.Equal(t, []internal.KeyRename{{From: "updated", To: []string{"lastmod"}}}, a.Renamed)
+	assert.Len(t, a.Warnings, 1)
+	assert.Positive(t, a.Duration)
+	assert.Equal(t, internal.FormatTOML, b.Format)
+	assert.Equal(t, internal.StatusFailed, bad.Status)
+	assert.Equal(t, report.Errors[0], bad.Error)
+	assert.Equal(t, filepath.Join(srcDir, "bad.md"), bad.Error.SourceFile)
+	assert.Equal(t, internal.AssetCopy, image.Asset)
+	assert.Equal(t, internal.StatusConverted, image.Status)
+	assert.Equal(t, 2, report.Count(internal.StatusConverted, false))
+	assert.Equal(t, 1, report.Count(internal.StatusConverted, true))
+
+	// Incremental runs report the posts they skip and the outputs they remove
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "bad.md")))
+	cfg.Incremental, cfg.Prune = true, true
+	_, err = internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "b.md")))
+	report, err = internal.ConvertPosts(context.Background(), srcDir, dstDir, cfg)
+	require.NoError(t, err)
+	require.Len(t, report.Files, 3)
+	assert.Equal(t, internal.StatusSkipped, report.Files[0].Status)
+	assert.Equal(t, internal.StatusRemoved, report.Files[1].Status)
+	assert.Equal(t, filepath.Join(dstDir, "b.md"), report.Files[1].Destination)
+	assert.Equal(t, internal.StatusSkipped, report.Files[2].Status)
+	assert.Equal(t, 1, report.Count(internal.StatusSkipped, true))
+}
+
+// TestReportFormats tests the JSON, JSON Lines and JUnit reports of a run
+func TestReportFormats(t *testing.T) {
+	srcDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.md"), []byte("---\ntitle: A\nupdated: 2021-03-04\n---\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "bad.md"), []byte("---\ntitle: [\n---\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "none.md"), []byte("no front matter\n"), 0644))
+
+	run := func(format internal.ReportFormat) string {
+		var buf bytes.Buffer
+		writer, err := internal.NewReportWriter(&buf, format)
+		require.NoError(t, err)
+		cfg := internal.NewDefaultConfig()
+		cfg.MaxConcurrency = 1
+		cfg.OnFile = writer.File
+		report, err := internal.ConvertPosts(context.Background(), srcDir, t.TempDir(), cfg)
+		require.Error(t, err)
+		require.NoError(t, writer.Finish(report))
+		return buf.String()
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var doc struct {
+			Converted, Failed int
+			Files             []struct {
+				Source, Status string
+				Renamed        []internal.KeyRename
+				Error          *struct{ Code, Message string }
+			}
+			Errors []struct {
+				Code string
+				Line int
+			}
+		}
+		require.NoError(t, json.Unmarshal([]byte(run(internal.ReportJSON)), &doc))
+		assert.Equal(t, 1, doc.Converted)
+		assert.Equal(t, 2, doc.Failed)
+		require.Len(t, doc.Files, 3)
+		assert.Equal(t, "converted", doc.Files[0].Status)
+		assert.Equal(t, []internal.KeyRename{{From: "updated", To: []string{"lastmod"}}}, doc.Files[0].Renamed)
+		assert.Nil(t, doc.Files[0].Error)
+		require.NotNil(t, doc.Files[1].Error)
+		assert.Equal(t, string(internal.CodeMalformedFrontMatter), doc.Files[1].Error.Code)
+		assert.Equal(t, string(internal.CodeMissingFrontMatter), doc.Files[2].Error.Code)
+		require.Len(t, doc.Errors, 2)
+		assert.Equal(t, 2, doc.Errors[0].Line)
+	})
+
+	t.Run("JSON Lines", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(run(internal.ReportJSONL)), "\n")
+		require.Len(t, lines, 4)
+		var events []map[string]interface{}
+		for _, line := range lines {
+			var event map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(line), &event))
+			events = append(events, event)
+		}
+		assert.Equal(t, "file", events[0]["event"])
+		assert.Equal(t, filepath.Join(srcDir, "a.md"), events[0]["source"])
+		assert.Equal(t, "summary", events[3]["event"])
+		assert.Equal(t, 2.0, events[3]["failed"])
+	})
+
+	t.Run("JUnit", func(t *testing.T) {
+		var suites struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Suites   []struct {
+				Cases []struct {
+					Name     string `xml:"name,attr"`
+					Failures []struct {
+						Type string `xml:"type,attr"`
+					} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		require.NoError(t, xml.Unmarshal([]byte(run(internal.ReportJUnit)), &suites))
+		assert.Equal(t, 3, suites.Tests)
+		assert.Equal(t, 2, suites.Failures)
+		require.Len(t, suites.Suites, 1)
+		cases := suites.Suites[0].Cases
+		require.Len(t, cases, 3)
+		assert.Equal(t, "a.md", cases[0].Name)
+		assert.Empty(t, cases[0].Failures)
+		require.Len(t, cases[1].Failures, 1)
+		assert.Equal(t, string(internal.CodeMalformedFrontMatter), cases[1].Failures[0].Type)
+	})
+
+	assert.Equal(t, internal.ReportJSONL, internal.ReportFormatFor("report.jsonl"))
+	assert.Equal(t, internal.ReportJUnit, internal.ReportFormatFor("junit.xml"))
+	assert.Equal(t, internal.ReportJSON, internal.ReportFormatFor("report.json"))
+	_, err := internal.NewReportWriter(io.Discard, "yaml")
+	assert.ErrorIs(t, err, internal.ErrUnsupportedFormat)
+}
+
+// TestLogging tests that each file's log events share a correlation ID
+func TestLogging(t *testing.T) {
+	srcDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.md"), []byte("---\ntitle: A\nupdated: 2021-03-04\n---\n{% note %}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.md"), []byte("---\ntitle: [\n---\n"), 0644))
+
+	var buf bytes.Buffer
+	cfg := internal.NewDefaultConfig()
+	cfg.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, err := internal.ConvertPosts(context.Background(), srcDir, t.TempDir(), cfg)
+	require.Error(t, err)
+
+	events := make(map[string][]map[string]interface{})
+	ids := make(map[string]map[interface{}]bool)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		file := filepath.Base(event["file"].(string))
+		events[file] = append(events[file], event)
+		if ids[file] == nil {
+			ids[file] = make(map[interface{}]bool)
+		}
+		ids[file][event["correlation_id"]] = true
+	}
+
+	messages := func(file string) []string {
+		var msgs []string
+		for _, event := range events[file] {
+			msgs = append(msgs, fmt.Sprintf("%s %s", event["level"], event["msg"]))
+		}
+		return msgs
+	}
+	assert.Equal(t, []string{
+		"DEBUG detected front matter format",
+		"DEBUG renamed key",
+		"WARN unsupported Hexo tag {% note %}",
+		"DEBUG wrote file",
+		"DEBUG file done",
+	}, messages("a.md"))
+	assert.Equal(t, []string{"DEBUG detected front matter format", "ERROR conversion failed"}, messages("b.md"))
+	assert.Equal(t, "malformed-front-matter", events["b.md"][1]["code"])
+	assert.Len(t, ids["a.md"], 1)
+	assert.Len(t, ids["b.md"], 1)
+	assert.NotEqual(t, ids["a.md"], ids["b.md"])
+}
+
+// TestProjectFile tests that project files are found and loaded, and that profiles are layered over their top level
+func TestProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "h2h.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`src = "source/_posts"
+target-format = "toml"
+key-order = ["title", "date"]
+max-concurrency = 4
+
+[mappings]
+rules = [{ from = "cover", to = "images" }]
+
+[profiles.docs]
+target-format = "json"
+convert-tags = true
+
+[profiles.docs.layout-rules]
+rules = [{ from = "source/docs", to = "content/docs" }]
+`), 0644))
+
+	assert.Equal(t, path, internal.FindProjectFile(t.TempDir(), dir))
+	assert.Empty(t, internal.FindProjectFile(t.TempDir()))
+
+	file, err := internal.LoadProjectFile(path)
+	require.NoError(t, err)
+
+	settings, err := file.Settings("")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"src":             "source/_posts",
+		"target-format":   "toml",
+		"key-order":       "title,date",
+		"max-concurrency": "4",
+	}, settings.Options)
+	require.NotNil(t, settings.Mappings)
+	assert.Equal(t, "cover", settings.Mappings.Rules[0].From)
+	assert.Nil(t, settings.Layout)
+
+	settings, err = file.Settings("docs")
+	require.NoError(t, err)
+	assert.Equal(t, "json", settings.Options["target-format"])
+	assert.Equal(t, "true", settings.Options["convert-tags"])
+	assert.Equal(t, "source/_posts", settings.Options["src"])
+	assert.NotNil(t, settings.Mappings)
+	require.NotNil(t, settings.Layout)
+	assert.Equal(t, "content/docs", settings.Layout.Rules[0].To)
+
+	_, err = file.Settings("blog")
+	assert.ErrorIs(t, err, internal.ErrUnknownProfile)
+
+	testCases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"map option", "src:\n  a: b\n", "option src must be a value or a list of values"},
+		{"invalid mapping rule", "mappings:\n  rules:\n    - from: a\n", "invalid mapping rule: a: needs to or delete"},
+		{"invalid layout rule", "profiles:\n  docs:\n    layout-rules:\n      rules:\n        - from: a\n", "profile docs: rule needs from and to paths"},
+		{"profile not a map", "profiles:\n  docs: 1\n", "profile docs must be a map of settings"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".h2h.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0644))
+			_, err := internal.LoadProjectFile(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+// h2hBinary builds the h2h command once for the tests that run it
+var h2hBinary = sync.OnceValues(func() (string, error) {
+	dir, err := os.MkdirTemp("", "h2h-bin")
+	if err != nil {
+		return "", err
+	}
+	bin := filepath.Join(dir, "h2h")
+	out, err := exec.Command("go", "build", "-o", bin, "..").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("building h2h: %w\n%s", err, out)
+	}
+	return bin, nil
+})
+
+// runH2H runs the h2h command in dir with env added to the environment, and returns its output
+func runH2H(t *testing.T, dir string, env []string, args ...string) (string, error) {
+	bin, err := h2hBinary()
+	require.NoError(t, err)
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// TestLogFileDefault tests that only conversions that write posts leave the default log file behind
+func TestLogFileDefault(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "posts"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "posts", "a.md"), []byte("---\ntitle: A\n---\n"), 0644))
+	logFile := filepath.Join(dir, "h2h.log")
+
+	out, err := runH2H(t, dir, nil, "--src", "posts", "--dst", "out", "--dry-run")
+	require.NoError(t, err, out)
+	assert.NoFileExists(t, logFile)
+	assert.NoDirExists(t, filepath.Join(dir, "out"))
+
+	out, err = runH2H(t, dir, nil, "--src", "posts", "--dst", "out", "--dry-run", "--log-file", "dry.log")
+	require.NoError(t, err, out)
+	assert.FileExists(t, filepath.Join(dir, "dry.log"))
+
+	out, err = runH2H(t, dir, nil, "--src", "posts", "--dst", "out")
+	require.NoError(t, err, out)
+	assert.FileExists(t, logFile)
+}
+
+// TestProjectCommand tests that the command layers flags over H2H_ environment variables over
+// the selected profile over the top level of the project file
+func TestProjectCommand(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "site", "posts"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "posts", "a.md"), []byte("---\ntitle: A\ncover: a.png\n---\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "h2h.yaml"), []byte(`src: posts
+dst: out
+target-format: toml
+mappings:
+    rules:
+        -   from: cover
+            to: images
+profiles:
+    docs:
+        target-format: json
+        dst: out-docs
+`), 0644))
+	read := func(path string) string {
+		content, err := os.ReadFile(filepath.Join(dir, "site", path))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	testCases := []struct {
+		name     string
+		cwd      string
+		env      []string
+		args     []string
+		path     string
+		expected string
+	}{
+		{"top level, relative to the file", dir, nil, []string{"--config", "site/h2h.yaml"}, "out/a.md", "+++\ntitle = \"A\"\nimages = \"a.png\"\n+++\n"},
+		{"found in the working directory", filepath.Join(dir, "site"), nil, nil, "out/a.md", "+++\ntitle = \"A\"\nimages = \"a.png\"\n+++\n"},
+		{"profile over top level", filepath.Join(dir, "site"), nil, []string{"--profile", "docs"}, "out-docs/a.md", "{\n    \"title\": \"A\",\n    \"images\": \"a.png\"\n}\n"},
+		{"environment over profile", filepath.Join(dir, "site"), []string{"H2H_PROFILE=docs", "H2H_TARGET_FORMAT=yaml"}, nil, "out-docs/a.md", "---\ntitle: A\nimages: a.png\n---\n"},
+		{"flags over environment", filepath.Join(dir, "site"), []string{"H2H_TARGET_FORMAT=yaml", "H2H_DST=env-out"}, []string{"--target-format", "json", "--json-indent", "0"}, "env-out/a.md", "{\"title\":\"A\",\"images\":\"a.png\"}\n"},
+		{"in-place leaves out dst", filepath.Join(dir, "site"), nil, []string{"--in-place", "--dry-run"}, "posts/a.md", "---\ntitle: A\ncover: a.png\n---\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := runH2H(t, tc.cwd, tc.env, tc.args...)
+			require.NoError(t, err, out)
+			assert.Equal(t, tc.expected, read(tc.path))
+		})
+	}
+
+	// The config command does not take the post directories of the project file as its files
+	out, err := runH2H(t, filepath.Join(dir, "site"), nil, "config")
+	require.Error(t, err)
+	assert.Contains(t, out, `required flag(s) "src" not set`)
+
+	out, err = runH2H(t, filepath.Join(dir, "site"), []string{"H2H_MAX_CONCURRENCY=many"})
+	require.Error(t, err)
+	assert.Contains(t, out, "H2H_MAX_CONCURRENCY")
+
+	out, err = runH2H(t, filepath.Join(dir, "site"), nil, "--profile", "blog")
+	require.Error(t, err)
+	assert.Contains(t, out, "unknown profile blog")
+}
+
 // BenchmarkConvertPosts benchmarks the conversion process
 func BenchmarkConvertPosts(b *testing.B) {
 	benchmarks := []struct {
@@ -374,7 +2221,7 @@ func BenchmarkConvertPosts(b *testing.B) {
 			// Reset timer before running the actual benchmark
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
-				err := internal.ConvertPosts(env.SrcDir, env.DstDir, env.Config)
+				_, err := internal.ConvertPosts(context.Background(), env.SrcDir, env.DstDir, env.Config)
 				if err != nil {
 					b.Fatalf("ConvertPosts failed: %v", err)
 				}